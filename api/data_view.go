@@ -3,11 +3,15 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
+	"github.com/MunishMummadi/web-scrapper/crawler"
 	"github.com/MunishMummadi/web-scrapper/database"
 )
 
@@ -18,23 +22,48 @@ type PageData struct {
 	ContentHash string    `json:"content_hash"`
 }
 
+// DecisionData represents a frontier decision for a discovered URL
+type DecisionData struct {
+	CrawlID   string    `json:"crawl_id"`
+	URL       string    `json:"url"`
+	ParentURL string    `json:"parent_url,omitempty"`
+	Depth     int       `json:"depth"`
+	Decision  string    `json:"decision"`
+	Reason    string    `json:"reason"`
+	DecidedAt time.Time `json:"decided_at"`
+}
+
 // StatsData represents stats for the dashboard
 type StatsData struct {
-	TotalUrls  int    `json:"total_urls"`
-	QueuedUrls int    `json:"queued_urls"`
-	CrawlRate  int    `json:"crawl_rate"`
-	ErrorRate  string `json:"error_rate"`
+	TotalUrls       int                `json:"total_urls"`
+	QueuedUrls      int                `json:"queued_urls"`  // Ready and delayed tasks in the queue
+	DelayedUrls     int                `json:"delayed_urls"` // Tasks waiting for a retry or a busy host
+	QueueByPriority map[string]int     `json:"queue_by_priority"`
+	InFlight        int                `json:"in_flight"` // Dequeued tasks not settled yet, across all nodes
+	WorkerPool      int                `json:"worker_pool"`
+	WorkersRunning  int                `json:"workers_running"`
+	WorkersBusy     int                `json:"workers_busy"`
+	CrawlRate       float64            `json:"crawl_rate"` // Pages per minute over the last 5 minutes
+	PagesPerMinute  map[string]float64 `json:"pages_per_minute"`
+	ErrorRate       string             `json:"error_rate"` // Failed fetch attempts over the last 5 minutes
+	ErrorRates      map[string]float64 `json:"error_rates"`
+	OpenCircuits    int                `json:"open_circuits"`
+	ThrottledHosts  int                `json:"throttled_hosts"`
+	HealthyProxies  int                `json:"healthy_proxies"`
+	TotalProxies    int                `json:"total_proxies"`
 }
 
 // DataViewHandler handles requests to view scraped data
 type DataViewHandler struct {
 	storage database.Storage
+	crawler *crawler.Crawler
 }
 
-// NewDataViewHandler creates a new handler for viewing data
-func NewDataViewHandler(storage database.Storage) *DataViewHandler {
+// NewDataViewHandler creates a new handler for viewing data and the crawler's live stats
+func NewDataViewHandler(storage database.Storage, c *crawler.Crawler) *DataViewHandler {
 	return &DataViewHandler{
 		storage: storage,
+		crawler: c,
 	}
 }
 
@@ -46,8 +75,8 @@ func (h *DataViewHandler) RegisterRoutes(mux *http.ServeMux) {
 	// API routes
 	mux.HandleFunc("/api/data", h.handleAPIData)
 	mux.HandleFunc("/api/stats", h.handleAPIStats)
-	mux.HandleFunc("/api/jobs", h.handleAPIJobs)
 	mux.HandleFunc("/api/settings", h.handleAPISettings)
+	mux.HandleFunc("/api/decisions", h.handleAPIDecisions)
 }
 
 // handleDashboard renders a simple dashboard view
@@ -68,10 +97,9 @@ func (h *DataViewHandler) handleDashboard(w http.ResponseWriter, r *http.Request
 		return
 	}
 	
-	// Get total count of pages
-	totalCount, err := h.storage.GetScrapedPagesCount(ctx)
+	stats, err := h.stats(ctx)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get page count: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to get stats: %v", err), http.StatusInternalServerError)
 		return
 	}
 	
@@ -98,6 +126,9 @@ func (h *DataViewHandler) handleDashboard(w http.ResponseWriter, r *http.Request
     <div class="stats">
         <h2>Stats</h2>
         <p>Total URLs: %d</p>
+        <p>Queued URLs: %d (%d in flight)</p>
+        <p>Crawl rate: %.1f pages/min, error rate %s (last 5 minutes)</p>
+        <p>Open circuits: %d</p>
     </div>
     
     <div>
@@ -107,18 +138,21 @@ func (h *DataViewHandler) handleDashboard(w http.ResponseWriter, r *http.Request
                 <th>URL</th>
                 <th>Scraped At</th>
                 <th>Content Hash</th>
+                <th>Changes</th>
             </tr>
-`, totalCount)
+`, stats.TotalUrls, stats.QueuedUrls, stats.InFlight, stats.CrawlRate, stats.ErrorRate, stats.OpenCircuits)
 	
 	// Add table rows for each page
 	for _, page := range pages {
+		query := url.QueryEscape(page.URL)
 		fmt.Fprintf(w, `
             <tr>
                 <td>%s</td>
                 <td>%s</td>
                 <td>%s</td>
+                <td><a href="/api/pages/diff?url=%s">diff</a> | <a href="/api/pages/history?url=%s">history</a></td>
             </tr>
-`, page.URL, page.ScrapedAt.Format(time.RFC3339), page.ContentHash)
+`, html.EscapeString(page.URL), page.ScrapedAt.Format(time.RFC3339), page.ContentHash, query, query)
 	}
 	
 	// Close the HTML
@@ -204,98 +238,208 @@ func (h *DataViewHandler) handleAPIData(w http.ResponseWriter, r *http.Request)
 	}
 }
 
-// handleAPIStats returns stats as JSON for the dashboard
-func (h *DataViewHandler) handleAPIStats(w http.ResponseWriter, r *http.Request) {
+// handleAPIDecisions returns recent frontier decisions as JSON, optionally filtered by crawl_id
+func (h *DataViewHandler) handleAPIDecisions(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 || limit > 1000 {
+		limit = 100
+	}
+	crawlID := r.URL.Query().Get("crawl_id")
+
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
-	
-	// Get total count of pages
-	totalCount, err := h.storage.GetScrapedPagesCount(ctx)
+
+	decisions, err := h.storage.GetURLDecisions(ctx, crawlID, limit)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get page count: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to get decisions: %v", err), http.StatusInternalServerError)
 		return
 	}
-	
-	// In a real implementation, these would come from metrics or other sources
-	stats := StatsData{
-		TotalUrls:  totalCount,
-		QueuedUrls: 0, // Would come from queue in a real implementation
-		CrawlRate:  10, // Would be calculated in a real implementation
-		ErrorRate:  "5%", // Would be calculated in a real implementation
+
+	data := make([]DecisionData, 0, len(decisions))
+	for _, d := range decisions {
+		data = append(data, DecisionData{
+			CrawlID:   d.CrawlID,
+			URL:       d.URL,
+			ParentURL: d.ParentURL,
+			Depth:     d.Depth,
+			Decision:  d.Decision,
+			Reason:    d.Reason,
+			DecidedAt: d.DecidedAt,
+		})
 	}
-	
+
 	// Return JSON response
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(stats); err != nil {
+	if err := json.NewEncoder(w).Encode(data); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
 	}
 }
 
-// handleAPIJobs returns active jobs as JSON
-func (h *DataViewHandler) handleAPIJobs(w http.ResponseWriter, r *http.Request) {
-	// In a real implementation, this would get active jobs from a job manager
-	jobs := []struct {
-		ID     string `json:"id"`
-		URL    string `json:"url"`
-		Status string `json:"status"`
-	}{}
+// handleAPIStats returns stats as JSON for the dashboard
+func (h *DataViewHandler) handleAPIStats(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	
+	stats, err := h.stats(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get stats: %v", err), http.StatusInternalServerError)
+		return
+	}
 	
 	// Return JSON response
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(jobs); err != nil {
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
 	}
 }
 
-// handleAPISettings returns or updates settings
+// stats gathers the page count and the crawler's live stats
+func (h *DataViewHandler) stats(ctx context.Context) (StatsData, error) {
+	totalCount, err := h.storage.GetScrapedPagesCount(ctx)
+	if err != nil {
+		return StatsData{}, fmt.Errorf("failed to get page count: %w", err)
+	}
+
+	live, err := h.crawler.Stats(ctx)
+	if err != nil {
+		return StatsData{}, fmt.Errorf("failed to get crawler stats: %w", err)
+	}
+
+	return StatsData{
+		TotalUrls:       totalCount,
+		QueuedUrls:      live.Queue.Len(),
+		DelayedUrls:     live.Queue.Delayed,
+		QueueByPriority: live.Queue.ByPriority,
+		InFlight:        live.Queue.InFlight,
+		WorkerPool:      live.WorkerPool,
+		WorkersRunning:  live.WorkersRunning,
+		WorkersBusy:     live.WorkersBusy,
+		CrawlRate:       live.PagesPerMinute["5m"],
+		PagesPerMinute:  live.PagesPerMinute,
+		ErrorRate:       fmt.Sprintf("%.1f%%", live.ErrorRate["5m"]*100),
+		ErrorRates:      live.ErrorRate,
+		OpenCircuits:    live.OpenCircuits,
+		ThrottledHosts:  live.ThrottledHosts,
+		HealthyProxies:  live.HealthyProxies,
+		TotalProxies:    live.Proxies,
+	}, nil
+}
+
+// SettingsData represents the crawler settings that can be changed at runtime
+type SettingsData struct {
+	WorkerCount   int    `json:"worker_count"`
+	UserAgent     string `json:"user_agent"`
+	RespectRobots bool   `json:"respect_robots"`
+	DefaultDelay  string `json:"default_delay"` // Go duration, e.g. "1s"
+	MaxRetries    int    `json:"max_retries"`
+	RetryDelay    string `json:"retry_delay"`
+}
+
+// SettingsUpdate changes the settings it sets and leaves the omitted ones as they are
+type SettingsUpdate struct {
+	WorkerCount   *int    `json:"worker_count,omitempty"`
+	UserAgent     *string `json:"user_agent,omitempty"`
+	RespectRobots *bool   `json:"respect_robots,omitempty"`
+	DefaultDelay  *string `json:"default_delay,omitempty"`
+	MaxRetries    *int    `json:"max_retries,omitempty"`
+	RetryDelay    *string `json:"retry_delay,omitempty"`
+}
+
+// SettingsErrorData reports why a settings update was rejected
+type SettingsErrorData struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields,omitempty"` // Reason by invalid field
+}
+
+// handleAPISettings returns the live crawler settings on GET and updates them on POST or PATCH
 func (h *DataViewHandler) handleAPISettings(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		// Return current settings (mock data for now)
-		settings := struct {
-			MaxConcurrency int    `json:"max_concurrency"`
-			UserAgent      string `json:"user_agent"`
-			RespectRobots  bool   `json:"respect_robots"`
-		}{
-			MaxConcurrency: 5,
-			UserAgent:      "WebScraper/1.0",
-			RespectRobots:  true,
-		}
-		
-		// Return JSON response
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(settings); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, settingsData(h.crawler.Settings()))
+	case http.MethodPost, http.MethodPatch:
+		var update SettingsUpdate
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&update); err != nil {
+			writeJSON(w, http.StatusBadRequest, SettingsErrorData{Error: fmt.Sprintf("Failed to decode request: %v", err)})
+			return
 		}
-	} else if r.Method == http.MethodPost {
-		// Parse settings from request body
-		var settings struct {
-			MaxConcurrency int    `json:"max_concurrency"`
-			UserAgent      string `json:"user_agent"`
-			RespectRobots  bool   `json:"respect_robots"`
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		// Merged into the current settings by the crawler, so concurrent updates don't race
+		settings, err := h.crawler.UpdateSettings(ctx, func(current crawler.Settings) (crawler.Settings, error) {
+			settings, fields := update.apply(current)
+			if len(fields) > 0 {
+				return crawler.Settings{}, &crawler.SettingsError{Fields: fields}
+			}
+			return settings, nil
+		})
+		var settingsErr *crawler.SettingsError
+		switch {
+		case errors.As(err, &settingsErr):
+			writeJSON(w, http.StatusBadRequest, SettingsErrorData{Error: "Invalid settings", Fields: settingsErr.Fields})
+		case err != nil:
+			writeJSON(w, http.StatusInternalServerError, SettingsErrorData{Error: fmt.Sprintf("Failed to update settings: %v", err)})
+		default:
+			writeJSON(w, http.StatusOK, settingsData(settings))
 		}
-		
-		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to decode request: %v", err), http.StatusBadRequest)
-			return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// apply returns the settings with the update applied, and the reason by field for every invalid one
+func (u SettingsUpdate) apply(settings crawler.Settings) (crawler.Settings, map[string]string) {
+	fields := make(map[string]string)
+	if u.WorkerCount != nil {
+		settings.WorkerCount = *u.WorkerCount
+	}
+	if u.UserAgent != nil {
+		settings.UserAgent = *u.UserAgent
+	}
+	if u.RespectRobots != nil {
+		settings.RespectRobots = *u.RespectRobots
+	}
+	if u.MaxRetries != nil {
+		settings.MaxRetries = *u.MaxRetries
+	}
+	if u.DefaultDelay != nil {
+		if d, err := time.ParseDuration(*u.DefaultDelay); err != nil {
+			fields["default_delay"] = fmt.Sprintf("invalid duration %q", *u.DefaultDelay)
+		} else {
+			settings.DefaultDelay = d
 		}
-		
-		// Validate settings
-		if settings.MaxConcurrency < 1 {
-			http.Error(w, "Max concurrency must be at least 1", http.StatusBadRequest)
-			return
+	}
+	if u.RetryDelay != nil {
+		if d, err := time.ParseDuration(*u.RetryDelay); err != nil {
+			fields["retry_delay"] = fmt.Sprintf("invalid duration %q", *u.RetryDelay)
+		} else {
+			settings.RetryDelay = d
 		}
-		
-		if settings.UserAgent == "" {
-			http.Error(w, "User agent cannot be empty", http.StatusBadRequest)
-			return
+	}
+
+	// Report the other invalid fields along with the durations
+	var settingsErr *crawler.SettingsError
+	if errors.As(settings.Validate(), &settingsErr) {
+		for field, reason := range settingsErr.Fields {
+			if _, ok := fields[field]; !ok {
+				fields[field] = reason
+			}
 		}
-		
-		// In a real implementation, these would be saved to a settings store
-		
-		// Return success response
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintln(w, "Settings updated successfully")
-	} else {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+	return settings, fields
+}
+
+// settingsData converts the crawler settings for the API
+func settingsData(settings crawler.Settings) SettingsData {
+	return SettingsData{
+		WorkerCount:   settings.WorkerCount,
+		UserAgent:     settings.UserAgent,
+		RespectRobots: settings.RespectRobots,
+		DefaultDelay:  settings.DefaultDelay.String(),
+		MaxRetries:    settings.MaxRetries,
+		RetryDelay:    settings.RetryDelay.String(),
 	}
 }
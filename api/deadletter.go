@@ -0,0 +1,234 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/queue"
+)
+
+const replayBatchSize = 100
+
+// EnqueueFunc puts a task back on the crawl queue
+type EnqueueFunc func(ctx context.Context, task *queue.Task) error
+
+// DeadLetterHandler exposes the dead-letter queue for triage, replay and purge
+type DeadLetterHandler struct {
+	deadLetters queue.DeadLetterQueue
+	enqueue     EnqueueFunc
+}
+
+// deadLetterSelection selects dead-letter entries by ID, or all of them
+type deadLetterSelection struct {
+	IDs []string `json:"ids"`
+	All bool     `json:"all"`
+}
+
+// NewDeadLetterHandler creates a new handler for the dead-letter queue
+func NewDeadLetterHandler(deadLetters queue.DeadLetterQueue, enqueue EnqueueFunc) *DeadLetterHandler {
+	return &DeadLetterHandler{
+		deadLetters: deadLetters,
+		enqueue:     enqueue,
+	}
+}
+
+// RegisterRoutes registers the dead-letter routes
+func (h *DeadLetterHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/deadletter", h.handleDeadLetter)
+	mux.HandleFunc("/api/deadletter/replay", h.handleReplay)
+	mux.HandleFunc("/api/deadletter/purge", h.handlePurge)
+}
+
+// handleDeadLetter lists dead-lettered tasks on GET and purges them on DELETE
+func (h *DeadLetterHandler) handleDeadLetter(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.handleList(w, r)
+	case http.MethodDelete:
+		h.handlePurge(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleList returns a page of dead-lettered tasks, most recent failure first
+func (h *DeadLetterHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20 // Default to 20 per page
+	}
+
+	offset := (page - 1) * limit
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	totalCount, err := h.deadLetters.Count(ctx)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to count dead letters: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	entries, err := h.deadLetters.List(ctx, offset, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list dead letters: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		TotalCount  int                 `json:"total_count"`
+		TotalPages  int                 `json:"total_pages"`
+		CurrentPage int                 `json:"current_page"`
+		Limit       int                 `json:"limit"`
+		Data        []*queue.DeadLetter `json:"data"`
+	}{
+		TotalCount:  totalCount,
+		TotalPages:  (totalCount + limit - 1) / limit,
+		CurrentPage: page,
+		Limit:       limit,
+		Data:        entries,
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleReplay re-enqueues the selected dead-lettered tasks with a fresh attempt count
+func (h *DeadLetterHandler) handleReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	selection, err := decodeSelection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	// Replay only the entries there are now: a replayed task that fails again is
+	// dead-lettered as a newer entry and must not be taken again by this request
+	remaining := len(selection.IDs)
+	if selection.All {
+		remaining, err = h.deadLetters.Count(ctx)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to count dead letters: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	replayed := 0
+	for remaining > 0 {
+		// Replay explicit IDs in one go, everything else in batches, oldest first
+		entries, err := h.deadLetters.Take(ctx, selection.IDs, min(remaining, replayBatchSize))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to take dead letters: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		for i, entry := range entries {
+			task := entry.Task
+			task.Attempt = 0
+			task.EnqueuedAt = time.Now()
+			if err := h.enqueue(ctx, task); err != nil {
+				lost := h.putBack(entries[i:])
+				http.Error(w, fmt.Sprintf("Replayed %d tasks, then failed to enqueue %s: %v (%d tasks could not be put back)", replayed, task.URL, err, lost), http.StatusInternalServerError)
+				return
+			}
+			replayed++
+		}
+
+		if len(selection.IDs) > 0 || len(entries) == 0 {
+			break
+		}
+		remaining -= len(entries)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"replayed": replayed})
+}
+
+// putBack stores entries that were taken but not replayed again, so they are not
+// lost, and returns how many of them could not be stored. It doesn't use the
+// request context, which may be the one that just expired.
+func (h *DeadLetterHandler) putBack(entries []*queue.DeadLetter) int {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lost := 0
+	for _, entry := range entries {
+		if err := h.deadLetters.Add(ctx, entry); err != nil {
+			log.Printf("Error putting dead letter %s (%s) back: %v", entry.ID, entry.Task.URL, err)
+			lost++
+		}
+	}
+	return lost
+}
+
+// handlePurge deletes the selected dead-lettered tasks
+func (h *DeadLetterHandler) handlePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	selection, err := decodeSelection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	purged, err := h.deadLetters.Purge(ctx, selection.IDs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to purge dead letters: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+}
+
+// decodeSelection reads the IDs to act on from the JSON body or repeated id
+// query parameters. Acting on every entry must be requested explicitly with "all".
+func decodeSelection(r *http.Request) (deadLetterSelection, error) {
+	var selection deadLetterSelection
+	if r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&selection); err != nil {
+			return selection, fmt.Errorf("Failed to decode request: %v", err)
+		}
+	}
+	selection.IDs = append(selection.IDs, r.URL.Query()["id"]...)
+	if r.URL.Query().Get("all") == "true" {
+		selection.All = true
+	}
+
+	if len(selection.IDs) == 0 && !selection.All {
+		return selection, fmt.Errorf("Provide ids or set all to true")
+	}
+	if len(selection.IDs) > 0 && selection.All {
+		return selection, fmt.Errorf("Provide either ids or all, not both")
+	}
+	return selection, nil
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/blobstore"
+	"github.com/MunishMummadi/web-scrapper/database"
+	"github.com/pmezard/go-difflib/difflib"
+	"golang.org/x/net/html"
+)
+
+const (
+	diffModeText = "text" // Diff the visible text extracted from the HTML
+	diffModeHTML = "html" // Diff the raw bodies
+
+	defaultDiffContext = 3
+)
+
+// hiddenElements never contribute visible text
+var hiddenElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"svg":      true,
+}
+
+// blockElements start a new line of visible text
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true,
+	"dd": true, "div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "header": true, "hr": true, "li": true,
+	"main": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true,
+	"table": true, "td": true, "th": true, "title": true, "tr": true, "ul": true,
+}
+
+// handleDiff returns a unified diff between two stored versions of a page.
+// from and to are version IDs from the page history; by default the latest
+// version is compared with the one before it.
+func (h *PageHandler) handleDiff(w http.ResponseWriter, r *http.Request, pageURL string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.blobs == nil {
+		http.Error(w, "Body storage is disabled", http.StatusNotFound)
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = diffModeText
+	}
+	if mode != diffModeText && mode != diffModeHTML {
+		http.Error(w, "mode must be text or html", http.StatusBadRequest)
+		return
+	}
+	diffContext, err := strconv.Atoi(r.URL.Query().Get("context"))
+	if err != nil || diffContext < 0 {
+		diffContext = defaultDiffContext
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	from, to, status, err := h.diffVersions(ctx, pageURL, r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	var texts [2]string
+	for i, version := range []database.PageVersion{from, to} {
+		body, err := h.blobs.Get(ctx, version.ContentHash)
+		if errors.Is(err, blobstore.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("Body of version %d is not stored", version.ID), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get body of version %d: %v", version.ID, err), http.StatusInternalServerError)
+			return
+		}
+		if mode == diffModeText {
+			texts[i] = visibleText(body)
+		} else {
+			texts[i] = strings.TrimSuffix(string(body), "\n") // SplitLines terminates the last line itself
+		}
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(texts[0]),
+		B:        difflib.SplitLines(texts[1]),
+		FromFile: fmt.Sprintf("%s (version %d)", pageURL, from.ID),
+		ToFile:   fmt.Sprintf("%s (version %d)", pageURL, to.ID),
+		FromDate: from.FetchedAt.UTC().Format(time.RFC3339),
+		ToDate:   to.FetchedAt.UTC().Format(time.RFC3339),
+		Context:  diffContext,
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to diff versions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Diff-From", strconv.FormatInt(from.ID, 10))
+	w.Header().Set("X-Diff-To", strconv.FormatInt(to.ID, 10))
+	if diff == "" {
+		fmt.Fprintf(w, "No %s differences between version %d and version %d of %s\n", mode, from.ID, to.ID, pageURL)
+		return
+	}
+	fmt.Fprint(w, diff)
+}
+
+// diffVersions resolves the versions to compare. Only versions with a stored
+// body qualify; to defaults to the latest of them and from to the one before to.
+// On failure it returns the HTTP status to answer with.
+func (h *PageHandler) diffVersions(ctx context.Context, pageURL, fromID, toID string) (database.PageVersion, database.PageVersion, int, error) {
+	var from, to database.PageVersion
+	var status int
+	var err error
+
+	if toID != "" {
+		if to, status, err = h.diffVersion(ctx, pageURL, toID); err != nil {
+			return from, to, status, err
+		}
+	}
+	if fromID != "" {
+		if from, status, err = h.diffVersion(ctx, pageURL, fromID); err != nil {
+			return from, to, status, err
+		}
+	}
+	if from.ID != 0 && to.ID != 0 {
+		return from, to, http.StatusOK, nil
+	}
+
+	// Fill in the missing end(s) from the page history, newest first
+	versions, err := h.storage.GetPageVersions(ctx, pageURL, 1000)
+	if err != nil {
+		return from, to, http.StatusInternalServerError, fmt.Errorf("Failed to get page history: %v", err)
+	}
+	for _, v := range versions {
+		if v.ContentHash == "" {
+			continue
+		}
+		if to.ID == 0 {
+			to = v
+		} else if from.ID == 0 && v.ID != to.ID && !v.FetchedAt.After(to.FetchedAt) {
+			from = v
+		}
+		if from.ID != 0 && to.ID != 0 {
+			break
+		}
+	}
+
+	if to.ID == 0 {
+		return from, to, http.StatusNotFound, fmt.Errorf("No stored versions of %s", pageURL)
+	}
+	if from.ID == 0 {
+		return from, to, http.StatusNotFound, fmt.Errorf("No earlier version of %s to compare version %d with", pageURL, to.ID)
+	}
+	return from, to, http.StatusOK, nil
+}
+
+// diffVersion loads a version by ID and checks it belongs to the page and has a body
+func (h *PageHandler) diffVersion(ctx context.Context, pageURL, idStr string) (database.PageVersion, int, error) {
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return database.PageVersion{}, http.StatusBadRequest, fmt.Errorf("Invalid version id %q", idStr)
+	}
+
+	version, err := h.storage.GetPageVersion(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && version.URL != pageURL) {
+		return version, http.StatusNotFound, fmt.Errorf("Version %d of %s not found", id, pageURL)
+	}
+	if err != nil {
+		return version, http.StatusInternalServerError, fmt.Errorf("Failed to get version %d: %v", id, err)
+	}
+	if version.ContentHash == "" {
+		return version, http.StatusNotFound, fmt.Errorf("Version %d has no stored body (status %d)", id, version.StatusCode)
+	}
+	return version, http.StatusOK, nil
+}
+
+// visibleText extracts the text a browser would render from an HTML page,
+// one line per block element with whitespace collapsed
+func visibleText(body []byte) string {
+	z := html.NewTokenizer(bytes.NewReader(body))
+
+	var lines []string
+	var line strings.Builder
+	flush := func() {
+		if text := strings.Join(strings.Fields(line.String()), " "); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+
+	hidden := 0
+	for {
+		tokenType := z.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			// io.EOF or malformed HTML, either way we're done
+			flush()
+			return strings.Join(lines, "\n")
+		case html.TextToken:
+			if hidden == 0 {
+				line.Write(z.Text())
+			}
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			tag := string(name)
+			if hiddenElements[tag] {
+				switch tokenType {
+				case html.StartTagToken:
+					hidden++
+				case html.EndTagToken:
+					if hidden > 0 {
+						hidden--
+					}
+				}
+				continue
+			}
+			if blockElements[tag] {
+				flush()
+			}
+		}
+	}
+}
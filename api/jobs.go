@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/crawler"
+	"github.com/MunishMummadi/web-scrapper/database"
+)
+
+// JobHandler reports the progress of crawl jobs and pauses, resumes or cancels them
+type JobHandler struct {
+	storage database.Storage
+	crawler *crawler.Crawler
+}
+
+// JobData represents a crawl job and the progress of its tasks
+type JobData struct {
+	ID         string          `json:"id"`
+	Seeds      []string        `json:"seeds"`
+	Options    json.RawMessage `json:"options,omitempty"`
+	Status     string          `json:"status"`
+	Queued     int             `json:"queued"`
+	InFlight   int             `json:"in_flight"`
+	Succeeded  int             `json:"succeeded"`
+	Failed     int             `json:"failed"`
+	Skipped    int             `json:"skipped"`
+	StartedAt  time.Time       `json:"started_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+// NewJobHandler creates a new handler for crawl jobs
+func NewJobHandler(storage database.Storage, c *crawler.Crawler) *JobHandler {
+	return &JobHandler{
+		storage: storage,
+		crawler: c,
+	}
+}
+
+// RegisterRoutes registers the job routes
+func (h *JobHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/jobs", h.handleJobs)
+	mux.HandleFunc("/api/jobs/", h.handleJob)
+}
+
+// handleJobs returns a page of jobs, most recently started first, optionally filtered by status
+func (h *JobHandler) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 20 // Default to 20 per page
+	}
+
+	offset := (page - 1) * limit
+	status := r.URL.Query().Get("status")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	totalCount, err := h.storage.GetCrawlJobsCount(ctx, status)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to count jobs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	jobs, err := h.storage.GetCrawlJobs(ctx, status, limit, offset)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get jobs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	data := make([]JobData, 0, len(jobs))
+	for _, job := range jobs {
+		data = append(data, jobData(job))
+	}
+
+	response := struct {
+		TotalCount  int       `json:"total_count"`
+		TotalPages  int       `json:"total_pages"`
+		CurrentPage int       `json:"current_page"`
+		Limit       int       `json:"limit"`
+		Data        []JobData `json:"data"`
+	}{
+		TotalCount:  totalCount,
+		TotalPages:  (totalCount + limit - 1) / limit,
+		CurrentPage: page,
+		Limit:       limit,
+		Data:        data,
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleJob returns the job in /api/jobs/{id}, or pauses, resumes or cancels it
+// on POST /api/jobs/{id}/pause, /resume or /cancel
+func (h *JobHandler) handleJob(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/")
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	if action == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		job, err := h.storage.GetCrawlJob(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get job: %v", err), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, jobData(job))
+		return
+	}
+
+	var control func(context.Context, string) (database.CrawlJob, error)
+	switch action {
+	case "pause":
+		control = h.crawler.PauseJob
+	case "resume":
+		control = h.crawler.ResumeJob
+	case "cancel":
+		control = h.crawler.CancelJob
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	job, err := control(ctx, id)
+	switch {
+	case errors.Is(err, crawler.ErrJobNotFound):
+		http.Error(w, "Job not found", http.StatusNotFound)
+	case errors.Is(err, crawler.ErrJobState):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Failed to %s job: %v", action, err), http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusOK, jobData(job))
+	}
+}
+
+// jobData converts a stored job for the API
+func jobData(job database.CrawlJob) JobData {
+	data := JobData{
+		ID:        job.ID,
+		Seeds:     job.Seeds,
+		Status:    job.Status,
+		Queued:    job.Queued,
+		InFlight:  job.InFlight,
+		Succeeded: job.Succeeded,
+		Failed:    job.Failed,
+		Skipped:   job.Skipped,
+		StartedAt: job.StartedAt,
+	}
+	if job.Options != "" {
+		data.Options = json.RawMessage(job.Options)
+	}
+	if !job.FinishedAt.IsZero() {
+		data.FinishedAt = &job.FinishedAt
+	}
+	return data
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/blobstore"
+	"github.com/MunishMummadi/web-scrapper/database"
+)
+
+// PageHandler serves the stored content of scraped pages
+type PageHandler struct {
+	storage database.Storage
+	blobs   blobstore.Store
+}
+
+// NewPageHandler creates a new handler for scraped page content.
+// blobs may be nil when body storage is disabled.
+func NewPageHandler(storage database.Storage, blobs blobstore.Store) *PageHandler {
+	return &PageHandler{
+		storage: storage,
+		blobs:   blobs,
+	}
+}
+
+// PageVersionData represents one fetch in a page's history
+type PageVersionData struct {
+	ID          int64               `json:"id"`
+	FetchedAt   time.Time           `json:"fetched_at"`
+	StatusCode  int                 `json:"status_code"`
+	ContentHash string              `json:"content_hash,omitempty"`
+	Size        int                 `json:"size"`
+	Headers     map[string][]string `json:"headers,omitempty"`
+	Changed     bool                `json:"changed"`
+}
+
+// RegisterRoutes registers the page routes
+func (h *PageHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/pages/body", h.handleBody)
+	mux.HandleFunc("/api/pages/", h.handlePage)
+}
+
+// handlePage routes /api/pages/{url}/{action} requests. The page URL should be
+// percent-encoded, or passed as ?url= (e.g. /api/pages/diff?url=...).
+func (h *PageHandler) handlePage(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.EscapedPath(), "/api/pages/")
+	encodedURL, action := "", path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		encodedURL, action = path[:i], path[i+1:]
+	}
+
+	pageURL, err := url.PathUnescape(encodedURL)
+	if err != nil {
+		http.Error(w, "Invalid page URL", http.StatusBadRequest)
+		return
+	}
+	if pageURL == "" {
+		pageURL = r.URL.Query().Get("url")
+	}
+	// ServeMux collapses the "//" of URLs that were not encoded, put it back
+	for _, scheme := range []string{"http:/", "https:/"} {
+		if strings.HasPrefix(pageURL, scheme) && !strings.HasPrefix(pageURL, scheme+"/") {
+			pageURL = scheme + "/" + pageURL[len(scheme):]
+		}
+	}
+	if pageURL == "" {
+		http.Error(w, "URL is required", http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case "history":
+		h.handleHistory(w, r, pageURL)
+	case "diff":
+		h.handleDiff(w, r, pageURL)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleHistory returns every recorded fetch of a page, most recent first
+func (h *PageHandler) handleHistory(w http.ResponseWriter, r *http.Request, pageURL string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	versions, err := h.storage.GetPageVersions(ctx, pageURL, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get page history: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if len(versions) == 0 {
+		http.Error(w, "Page not found", http.StatusNotFound)
+		return
+	}
+
+	data := make([]PageVersionData, 0, len(versions))
+	for _, v := range versions {
+		data = append(data, PageVersionData{
+			ID:          v.ID,
+			FetchedAt:   v.FetchedAt,
+			StatusCode:  v.StatusCode,
+			ContentHash: v.ContentHash,
+			Size:        v.Size,
+			Headers:     v.Headers,
+			Changed:     v.Changed,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		URL      string            `json:"url"`
+		Versions []PageVersionData `json:"versions"`
+	}{
+		URL:      pageURL,
+		Versions: data,
+	})
+}
+
+// handleBody returns the raw body of a page, by URL (latest scrape) or by content hash
+func (h *PageHandler) handleBody(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.blobs == nil {
+		http.Error(w, "Body storage is disabled", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	hash := r.URL.Query().Get("hash")
+	pageURL := r.URL.Query().Get("url")
+	switch {
+	case hash != "":
+		if !blobstore.ValidHash(hash) {
+			http.Error(w, "Invalid content hash", http.StatusBadRequest)
+			return
+		}
+	case pageURL != "":
+		page, err := h.storage.GetPage(ctx, pageURL)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Page not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get page: %v", err), http.StatusInternalServerError)
+			return
+		}
+		hash = page.ContentHash
+		w.Header().Set("X-Scraped-At", page.ScrapedAt.UTC().Format(time.RFC3339))
+	default:
+		http.Error(w, "URL or hash parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	body, err := h.blobs.Get(ctx, hash)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		http.Error(w, "Body not stored for this page", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get body: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(body))
+	w.Header().Set("X-Content-Hash", hash)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(body)
+	}
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/database"
+	"github.com/MunishMummadi/web-scrapper/scheduler"
+)
+
+// ScheduleHandler manages cron-scheduled crawls
+type ScheduleHandler struct {
+	scheduler *scheduler.Scheduler
+}
+
+// ScheduleRequest creates or replaces a schedule. Options override the
+// configured crawl defaults, using the fields of an enqueue request
+// (max_depth, max_pages, max_pages_per_host, scope, priority, link_priority).
+type ScheduleRequest struct {
+	Name    string          `json:"name"`
+	Cron    string          `json:"cron"`
+	Seeds   []string        `json:"seeds"`
+	Options json.RawMessage `json:"options,omitempty"`
+	Enabled *bool           `json:"enabled,omitempty"` // Defaults to true
+}
+
+// ScheduleData represents a schedule and its run times
+type ScheduleData struct {
+	Name        string          `json:"name"`
+	Cron        string          `json:"cron"`
+	Seeds       []string        `json:"seeds"`
+	Options     json.RawMessage `json:"options,omitempty"`
+	Enabled     bool            `json:"enabled"`
+	Source      string          `json:"source"`
+	CreatedAt   time.Time       `json:"created_at"`
+	LastRunAt   *time.Time      `json:"last_run_at,omitempty"`
+	NextRunAt   *time.Time      `json:"next_run_at,omitempty"`
+	LastCrawlID string          `json:"last_crawl_id,omitempty"`
+}
+
+// NewScheduleHandler creates a new handler for crawl schedules
+func NewScheduleHandler(s *scheduler.Scheduler) *ScheduleHandler {
+	return &ScheduleHandler{scheduler: s}
+}
+
+// RegisterRoutes registers the schedule routes
+func (h *ScheduleHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/api/schedules", h.handleSchedules)
+	mux.HandleFunc("/api/schedules/", h.handleSchedule)
+}
+
+// handleSchedules lists schedules on GET and creates one on POST
+func (h *ScheduleHandler) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		schedules := h.scheduler.List()
+		data := make([]ScheduleData, 0, len(schedules))
+		for _, schedule := range schedules {
+			data = append(data, scheduleData(schedule))
+		}
+		writeJSON(w, http.StatusOK, data)
+	case http.MethodPost:
+		h.saveSchedule(w, r, "")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSchedule returns, replaces or deletes the schedule named in /api/schedules/{name}
+func (h *ScheduleHandler) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/api/schedules/")
+	if name == "" || strings.Contains(name, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		schedule, err := h.scheduler.Get(name)
+		if err != nil {
+			writeScheduleError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, scheduleData(schedule))
+	case http.MethodPut:
+		h.saveSchedule(w, r, name)
+	case http.MethodDelete:
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		if err := h.scheduler.Delete(ctx, name); err != nil {
+			writeScheduleError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// saveSchedule creates a schedule from the request body, or creates or replaces
+// the named one when name is set
+func (h *ScheduleHandler) saveSchedule(w http.ResponseWriter, r *http.Request, name string) {
+	var req ScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to decode request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if name != "" {
+		if req.Name != "" && req.Name != name {
+			http.Error(w, "Name in the body does not match the URL", http.StatusBadRequest)
+			return
+		}
+		req.Name = name
+	}
+
+	schedule := database.CrawlSchedule{
+		Name:    req.Name,
+		Cron:    req.Cron,
+		Seeds:   req.Seeds,
+		Enabled: req.Enabled == nil || *req.Enabled,
+	}
+	if len(req.Options) > 0 && string(req.Options) != "null" {
+		schedule.Options = string(req.Options)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var err error
+	status := http.StatusOK
+	if name == "" {
+		schedule, err = h.scheduler.Create(ctx, schedule)
+		status = http.StatusCreated
+	} else {
+		schedule, err = h.scheduler.Save(ctx, schedule)
+	}
+	if err != nil {
+		writeScheduleError(w, err)
+		return
+	}
+	writeJSON(w, status, scheduleData(schedule))
+}
+
+// writeScheduleError answers with the status matching a scheduler error
+func writeScheduleError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, scheduler.ErrInvalidSchedule):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, scheduler.ErrScheduleNotFound):
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+	case errors.Is(err, scheduler.ErrScheduleExists), errors.Is(err, scheduler.ErrConfigSchedule):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, fmt.Sprintf("Failed to update schedule: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// scheduleData converts a stored schedule for the API
+func scheduleData(schedule database.CrawlSchedule) ScheduleData {
+	data := ScheduleData{
+		Name:        schedule.Name,
+		Cron:        schedule.Cron,
+		Seeds:       schedule.Seeds,
+		Enabled:     schedule.Enabled,
+		Source:      schedule.Source,
+		CreatedAt:   schedule.CreatedAt,
+		LastCrawlID: schedule.LastCrawlID,
+	}
+	if schedule.Options != "" {
+		data.Options = json.RawMessage(schedule.Options)
+	}
+	if !schedule.LastRunAt.IsZero() {
+		data.LastRunAt = &schedule.LastRunAt
+	}
+	if !schedule.NextRunAt.IsZero() {
+		data.NextRunAt = &schedule.NextRunAt
+	}
+	return data
+}
@@ -0,0 +1,78 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/MunishMummadi/web-scrapper/config"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported backends
+const (
+	BackendFile = "file"
+	BackendS3   = "s3"
+	BackendNone = "none"
+)
+
+// ErrNotFound is returned when no blob is stored under a hash
+var ErrNotFound = errors.New("blob not found")
+
+// hashPattern matches the hex-encoded SHA-256 hashes blobs are addressed by
+var hashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Shared zstd codec, EncodeAll and DecodeAll are safe for concurrent use
+var (
+	encoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	decoder, _ = zstd.NewReader(nil)
+)
+
+// Store keeps response bodies zstd-compressed and addressed by the SHA-256
+// hash of their content, so identical bodies are stored only once
+type Store interface {
+	Put(ctx context.Context, hash string, body []byte) error
+	Get(ctx context.Context, hash string) ([]byte, error)
+	Delete(ctx context.Context, hash string) error
+	Close() error
+}
+
+// New creates the blob store selected in the configuration.
+// It returns a nil Store when body storage is disabled.
+func New(cfg config.BlobStoreConfig) (Store, error) {
+	switch cfg.Backend {
+	case BackendFile, "":
+		return NewFileStore(cfg.Path)
+	case BackendS3:
+		return NewS3Store(cfg.S3)
+	case BackendNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown blob store backend %q", cfg.Backend)
+	}
+}
+
+// ValidHash reports whether s is a content hash a blob can be stored under
+func ValidHash(s string) bool {
+	return hashPattern.MatchString(s)
+}
+
+// objectKey returns the relative location of a blob, fanned out by hash prefix
+func objectKey(hash string) string {
+	return hash[:2] + "/" + hash + ".zst"
+}
+
+// compress encodes a body with zstd
+func compress(body []byte) []byte {
+	return encoder.EncodeAll(body, make([]byte, 0, len(body)/2))
+}
+
+// decompress decodes a zstd-encoded body
+func decompress(data []byte) ([]byte, error) {
+	body, err := decoder.DecodeAll(data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress blob: %w", err)
+	}
+	return body, nil
+}
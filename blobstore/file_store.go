@@ -0,0 +1,97 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileStore implements Store on the local filesystem
+type FileStore struct {
+	root string
+}
+
+// NewFileStore creates a blob store rooted at the given directory
+func NewFileStore(root string) (Store, error) {
+	if root == "" {
+		return nil, fmt.Errorf("blob store path is required")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob store directory %s: %w", root, err)
+	}
+	return &FileStore{root: root}, nil
+}
+
+// Put stores a body under its content hash unless it is already present
+func (s *FileStore) Put(ctx context.Context, hash string, body []byte) error {
+	if !ValidHash(hash) {
+		return fmt.Errorf("invalid content hash %q", hash)
+	}
+
+	path := s.path(hash)
+	if _, err := os.Stat(path); err == nil {
+		return nil // Same content, already stored
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	// Write to a temporary file first so readers never see a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(path), hash+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob file: %w", err)
+	}
+	if _, err := tmp.Write(compress(body)); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write blob %s: %w", hash, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write blob %s: %w", hash, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to store blob %s: %w", hash, err)
+	}
+	return nil
+}
+
+// Get returns the decompressed body stored under a content hash
+func (s *FileStore) Get(ctx context.Context, hash string) ([]byte, error) {
+	if !ValidHash(hash) {
+		return nil, ErrNotFound
+	}
+
+	data, err := os.ReadFile(s.path(hash))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to read blob %s: %w", hash, err)
+	}
+	return decompress(data)
+}
+
+// Delete removes the body stored under a content hash, if any
+func (s *FileStore) Delete(ctx context.Context, hash string) error {
+	if !ValidHash(hash) {
+		return nil
+	}
+	if err := os.Remove(s.path(hash)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob %s: %w", hash, err)
+	}
+	return nil
+}
+
+// Close is a no-op for the file store
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// path returns the file a blob is stored in
+func (s *FileStore) path(hash string) string {
+	return filepath.Join(s.root, filepath.FromSlash(objectKey(hash)))
+}
@@ -0,0 +1,88 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewFileStore(root)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	body, hash := testBody(strings.Repeat("<p>Hello, world</p>", 100))
+	if err := store.Put(ctx, hash, body); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// Stored compressed, fanned out by hash prefix, with no temporary file left behind
+	path := filepath.Join(root, hash[:2], hash+".zst")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("blob file: %v", err)
+	}
+	if info.Size() >= int64(len(body)) {
+		t.Errorf("stored %d bytes for a %d byte body, want it compressed", info.Size(), len(body))
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("%d files next to the blob, want only the blob", len(entries))
+	}
+
+	got, err := store.Get(ctx, hash)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !bytes.Equal(got, body) {
+		t.Fatalf("Get returned %d bytes, want the %d byte body", len(got), len(body))
+	}
+
+	// Storing the same body again keeps the existing file
+	if err := store.Put(ctx, hash, body); err != nil {
+		t.Fatalf("second Put: %v", err)
+	}
+	if again, err := os.Stat(path); err != nil || !again.ModTime().Equal(info.ModTime()) {
+		t.Errorf("blob file rewritten by a second Put (err %v)", err)
+	}
+
+	if err := store.Delete(ctx, hash); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, hash); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete returned %v, want ErrNotFound", err)
+	}
+	// Deleting a missing blob is not an error
+	if err := store.Delete(ctx, hash); err != nil {
+		t.Fatalf("second Delete: %v", err)
+	}
+}
+
+func TestFileStoreRejectsInvalidHashes(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewFileStore(root)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	ctx := context.Background()
+
+	// A hash is used as a path, so anything else must never reach the filesystem
+	for _, hash := range []string{"", "../../etc/passwd", strings.Repeat("A", 64)} {
+		if err := store.Put(ctx, hash, []byte("x")); err == nil {
+			t.Errorf("Put accepted hash %q", hash)
+		}
+		if _, err := store.Get(ctx, hash); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get of hash %q returned %v, want ErrNotFound", hash, err)
+		}
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 0 {
+		t.Errorf("%d entries in the store after invalid writes, want none", len(entries))
+	}
+}
@@ -0,0 +1,221 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/config"
+)
+
+const (
+	s3RequestTimeout = 30 * time.Second
+	s3MaxErrorBody   = 1024 // Bytes of an error response included in the error message
+)
+
+// S3Store implements Store on an S3-compatible object store (AWS S3, MinIO, ...).
+// Objects are addressed path-style (endpoint/bucket/key), which every
+// S3-compatible service accepts, and requests are signed with AWS Signature V4.
+type S3Store struct {
+	client    *http.Client
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	region    string
+	accessKey string
+	secretKey string
+}
+
+// NewS3Store creates a blob store backed by an S3 bucket
+func NewS3Store(cfg config.S3Config) (Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("S3 endpoint and bucket are required")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &S3Store{
+		client:    &http.Client{Timeout: s3RequestTimeout},
+		endpoint:  endpoint,
+		bucket:    cfg.Bucket,
+		prefix:    strings.Trim(cfg.Prefix, "/"),
+		region:    region,
+		accessKey: cfg.AccessKey,
+		secretKey: cfg.SecretKey,
+	}, nil
+}
+
+// Put stores a body under its content hash unless it is already present
+func (s *S3Store) Put(ctx context.Context, hash string, body []byte) error {
+	if !ValidHash(hash) {
+		return fmt.Errorf("invalid content hash %q", hash)
+	}
+
+	resp, err := s.do(ctx, http.MethodHead, hash, nil)
+	if err != nil {
+		return fmt.Errorf("failed to check blob %s: %w", hash, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil // Same content, already stored
+	}
+	if resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to check blob %s: unexpected status %d", hash, resp.StatusCode)
+	}
+
+	resp, err = s.do(ctx, http.MethodPut, hash, compress(body))
+	if err != nil {
+		return fmt.Errorf("failed to upload blob %s: %w", hash, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to upload blob %s: %s", hash, errorResponse(resp))
+	}
+	return nil
+}
+
+// Get returns the decompressed body stored under a content hash
+func (s *S3Store) Get(ctx context.Context, hash string) ([]byte, error) {
+	if !ValidHash(hash) {
+		return nil, ErrNotFound
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, hash, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download blob %s: %w", hash, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("failed to download blob %s: %s", hash, errorResponse(resp))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download blob %s: %w", hash, err)
+	}
+	return decompress(data)
+}
+
+// Delete removes the object holding a body, if any
+func (s *S3Store) Delete(ctx context.Context, hash string) error {
+	if !ValidHash(hash) {
+		return nil
+	}
+
+	resp, err := s.do(ctx, http.MethodDelete, hash, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete blob %s: %w", hash, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return fmt.Errorf("failed to delete blob %s: %s", hash, errorResponse(resp))
+	}
+}
+
+// Close releases idle connections
+func (s *S3Store) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// do sends a signed request for the object holding a blob
+func (s *S3Store) do(ctx context.Context, method, hash string, body []byte) (*http.Response, error) {
+	key := objectKey(hash)
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket + "/" + key
+	u.RawPath = ""
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/zstd")
+	}
+
+	s.sign(req, body, time.Now())
+	return s.client.Do(req)
+}
+
+// sign adds AWS Signature V4 headers to a request. Requests are sent
+// unsigned when no access key is configured (e.g. a public test bucket).
+func (s *S3Store) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.accessKey == "" {
+		return
+	}
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// errorResponse summarizes an unexpected S3 response for an error message
+func errorResponse(resp *http.Response) string {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, s3MaxErrorBody))
+	return fmt.Sprintf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -11,11 +11,13 @@ import (
 )
 
 type Config struct {
-	API      APIConfig
-	Crawler  CrawlerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	Proxies  ProxyConfig
+	API       APIConfig
+	Crawler   CrawlerConfig
+	Database  DatabaseConfig
+	BlobStore BlobStoreConfig
+	Redis     RedisConfig
+	Proxies   ProxyConfig
+	Schedules []ScheduleConfig
 }
 
 type APIConfig struct {
@@ -39,17 +41,117 @@ type CrawlerConfig struct {
 	CircuitBreakerTime  time.Duration
 	HeadlessBrowser     bool
 	CacheExpiration     time.Duration
+	MaxDepth            int // Maximum link depth from the seed (0 = seed only)
+	MaxPagesPerCrawl    int // Maximum URLs admitted per crawl (0 = unlimited)
+	MaxPagesPerHost     int // Maximum URLs admitted per host within a crawl (0 = unlimited)
+	Scope               ScopeConfig
+	HostFrontier        bool          // Partition the queue by host so workers only get URLs they can fetch right away
+	SeenExpiration      time.Duration // How long an enqueued URL is remembered and not enqueued again (0 = forever)
+	DecisionRetention   time.Duration // How long frontier decisions are kept (0 = forever)
+	NodeID              string        // Identifies this node's in-flight work in shared storage; stable across restarts (default: hostname)
+	StripQueryParams    []string      // Query parameters removed during canonicalization, "utm_*" matches a prefix
+	Recrawl             RecrawlConfig
+	Autoscale           AutoscaleConfig
+	RetryPolicy         RetryPolicyConfig
+	Throttle            ThrottleConfig
+	Robots              RobotsConfig
+}
+
+// RobotsConfig controls how robots.txt files are cached and how their directives
+// beyond Allow/Disallow are followed
+type RobotsConfig struct {
+	MinCrawlDelay   time.Duration // Shortest Crawl-delay honoured, shorter ones are raised to it
+	MaxCrawlDelay   time.Duration // Longest Crawl-delay honoured, longer ones are capped to it (0 = no cap)
+	EnqueueSitemaps bool          // Enqueue the Sitemap URLs of robots.txt when a host is first seen
+	SuccessTTL      time.Duration // How long a robots.txt fetched with a 2xx is cached
+	ClientErrorTTL  time.Duration // How long a 4xx answer (everything allowed) is cached
+	ServerErrorTTL  time.Duration // How long a 5xx answer (the host is not fetched) is cached
+	NetworkErrorTTL time.Duration // How long a failed fetch (the host is not fetched) is cached
+}
+
+// ThrottleConfig controls how the crawler slows down for hosts that push back
+type ThrottleConfig struct {
+	AutoThrottle      bool          // Adapt each host's rate to 429/503 responses and observed latency
+	TargetConcurrency float64       // Requests a host should be handling at once, the delay aimed for is latency / targetConcurrency
+	MaxDelay          time.Duration // Longest spacing between requests to a throttled host
+	RecoverAfter      int           // Successful responses before a throttled host is sped up again
+	MaxRetryAfter     time.Duration // Longest Retry-After honoured
+}
+
+// RetryPolicyConfig sets how many times failed fetches are retried. A negative
+// number of retries stands for maxRetries.
+type RetryPolicyConfig struct {
+	Classes     map[string]int // Retries per error class (network, dns, tls, timeout, policy), the others get maxRetries
+	StatusCodes map[string]int // Retries per status code ("503") or status class ("5xx"), the others aren't retried
+}
+
+// AutoscaleConfig lets the crawler size its worker pool to the work available
+type AutoscaleConfig struct {
+	Enabled       bool
+	MinWorkers    int
+	MaxWorkers    int
+	Interval      time.Duration // How often the pool size is reconsidered
+	TargetLatency time.Duration // Average fetch latency above which workers are removed instead of added
+}
+
+// RecrawlConfig controls the adaptive revisiting of pages that were already crawled
+type RecrawlConfig struct {
+	Enabled       bool
+	MinInterval   time.Duration // Shortest time between two visits of a page
+	MaxInterval   time.Duration // Longest time between two visits of a page
+	CheckInterval time.Duration // How often due pages are looked up
+	BatchSize     int           // Maximum pages enqueued per check
+	MaxPerHost    int           // Maximum pages of one host enqueued per check (0 = unlimited)
+}
+
+// ScopeConfig decides which discovered URLs belong to a crawl
+type ScopeConfig struct {
+	Mode         string   `json:"mode,omitempty"`          // "host", "domain" (registered domain) or "any"
+	Include      []string `json:"include,omitempty"`       // Regexes, a URL must match at least one when set
+	Exclude      []string `json:"exclude,omitempty"`       // Regexes, a URL matching any of them is dropped
+	PathPrefixes []string `json:"path_prefixes,omitempty"` // Allowed path prefixes, empty allows every path
+}
+
+// ScheduleConfig defines a crawl that is started on a cron schedule
+type ScheduleConfig struct {
+	Name            string
+	Cron            string // Standard 5-field expression or a descriptor such as "@daily"
+	Seeds           []string
+	Disabled        bool
+	MaxDepth        *int // Crawl options, the crawler defaults apply to the ones left unset
+	MaxPages        *int
+	MaxPagesPerHost *int
+	Scope           *ScopeConfig
 }
 
 type DatabaseConfig struct {
 	FilePath string
 }
 
+// BlobStoreConfig selects where fetched response bodies are kept
+type BlobStoreConfig struct {
+	Backend string // "file", "s3" or "none" to disable body storage
+	Path    string // Root directory of the file backend
+	S3      S3Config
+}
+
+// S3Config configures an S3-compatible blob store backend
+type S3Config struct {
+	Endpoint  string // e.g. "https://s3.us-east-1.amazonaws.com" or "http://localhost:9000"
+	Region    string
+	Bucket    string
+	Prefix    string // Key prefix inside the bucket
+	AccessKey string
+	SecretKey string
+}
+
 type RedisConfig struct {
-	Host     string
-	Port     int
-	Password string
-	DB       int
+	Host              string
+	Port              int
+	Password          string
+	DB                int
+	VisibilityTimeout time.Duration // How long a dequeued task stays leased before it is redelivered
+	ReaperInterval    time.Duration // How often expired leases are requeued
 }
 
 type ProxyConfig struct {
@@ -115,13 +217,60 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("crawler.circuitBreakerTime", 5*time.Minute)
 	v.SetDefault("crawler.headlessBrowser", false)
 	v.SetDefault("crawler.cacheExpiration", 24*time.Hour)
+	v.SetDefault("crawler.maxDepth", 3)
+	v.SetDefault("crawler.maxPagesPerCrawl", 1000)
+	v.SetDefault("crawler.maxPagesPerHost", 0)
+	v.SetDefault("crawler.hostFrontier", true)
+	v.SetDefault("crawler.seenExpiration", 24*time.Hour)
+	v.SetDefault("crawler.decisionRetention", 7*24*time.Hour)
+	v.SetDefault("crawler.stripQueryParams", []string{"utm_*", "gclid", "fbclid", "msclkid", "mc_cid", "mc_eid"})
+	v.SetDefault("crawler.scope.mode", "domain")
+	v.SetDefault("crawler.scope.include", []string{})
+	v.SetDefault("crawler.scope.exclude", []string{})
+	v.SetDefault("crawler.scope.pathPrefixes", []string{})
+	v.SetDefault("crawler.recrawl.enabled", true)
+	v.SetDefault("crawler.recrawl.minInterval", 1*time.Hour)
+	v.SetDefault("crawler.recrawl.maxInterval", 30*24*time.Hour)
+	v.SetDefault("crawler.recrawl.checkInterval", 1*time.Minute)
+	v.SetDefault("crawler.recrawl.batchSize", 500)
+	v.SetDefault("crawler.recrawl.maxPerHost", 50)
+	v.SetDefault("crawler.retryPolicy.classes", map[string]int{"tls": 0})
+	v.SetDefault("crawler.retryPolicy.statusCodes", map[string]int{"408": -1, "425": -1, "429": -1, "5xx": -1, "501": 0})
+	v.SetDefault("crawler.throttle.autoThrottle", true)
+	v.SetDefault("crawler.throttle.targetConcurrency", 1.0)
+	v.SetDefault("crawler.throttle.maxDelay", 60*time.Second)
+	v.SetDefault("crawler.throttle.recoverAfter", 10)
+	v.SetDefault("crawler.throttle.maxRetryAfter", time.Hour)
+	v.SetDefault("crawler.robots.minCrawlDelay", 0)
+	v.SetDefault("crawler.robots.maxCrawlDelay", 60*time.Second)
+	v.SetDefault("crawler.robots.enqueueSitemaps", true)
+	v.SetDefault("crawler.robots.successTTL", 24*time.Hour)
+	v.SetDefault("crawler.robots.clientErrorTTL", 24*time.Hour)
+	v.SetDefault("crawler.robots.serverErrorTTL", 10*time.Minute)
+	v.SetDefault("crawler.robots.networkErrorTTL", 5*time.Minute)
+	v.SetDefault("crawler.autoscale.enabled", false)
+	v.SetDefault("crawler.autoscale.minWorkers", 2)
+	v.SetDefault("crawler.autoscale.maxWorkers", 50)
+	v.SetDefault("crawler.autoscale.interval", 15*time.Second)
+	v.SetDefault("crawler.autoscale.targetLatency", 5*time.Second)
 
 	v.SetDefault("database.filepath", "./data/scraper.db")
 
+	v.SetDefault("blobstore.backend", "file")
+	v.SetDefault("blobstore.path", "./data/blobs")
+	v.SetDefault("blobstore.s3.endpoint", "")
+	v.SetDefault("blobstore.s3.region", "us-east-1")
+	v.SetDefault("blobstore.s3.bucket", "")
+	v.SetDefault("blobstore.s3.prefix", "bodies")
+	v.SetDefault("blobstore.s3.accesskey", "")
+	v.SetDefault("blobstore.s3.secretkey", "")
+
 	v.SetDefault("redis.host", "localhost")
 	v.SetDefault("redis.port", 6379)
 	v.SetDefault("redis.password", "")
 	v.SetDefault("redis.db", 0)
+	v.SetDefault("redis.visibilityTimeout", 5*time.Minute)
+	v.SetDefault("redis.reaperInterval", 30*time.Second)
 
 	v.SetDefault("proxies.enabled", false)
 	v.SetDefault("proxies.urls", []string{})
@@ -0,0 +1,146 @@
+package crawler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/config"
+	"github.com/MunishMummadi/web-scrapper/queue"
+)
+
+const (
+	lowUtilization  = 0.3 // Share of time workers were busy below which the pool shrinks
+	highUtilization = 0.8 // Share of time workers were busy above which the pool may grow
+)
+
+// autoscaler resizes the worker pool between a minimum and a maximum from the
+// queue depth, how busy the workers were and how fast hosts answered
+type autoscaler struct {
+	crawler *Crawler
+	cfg     config.AutoscaleConfig
+
+	lastCheck      time.Time
+	lastBusy       int64 // Crawler.busyTime at the last check
+	lastFetchTime  int64 // Crawler.fetchTime at the last check
+	lastFetchCount int64 // Crawler.fetchCount at the last check
+}
+
+// autoscaleSample is what a pool size decision is based on
+type autoscaleSample struct {
+	workers     int
+	utilization float64       // Share of the interval the workers spent on tasks
+	latency     time.Duration // Average fetch latency over the interval, 0 without fetches
+	queue       queue.Stats
+}
+
+func newAutoscaler(c *Crawler, cfg config.AutoscaleConfig) *autoscaler {
+	if cfg.MinWorkers < 1 {
+		cfg.MinWorkers = 1
+	}
+	if cfg.MaxWorkers < cfg.MinWorkers {
+		cfg.MaxWorkers = cfg.MinWorkers
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 15 * time.Second
+	}
+	return &autoscaler{crawler: c, cfg: cfg}
+}
+
+// clamp bounds a worker count to the autoscaler's range
+func (a *autoscaler) clamp(workers int) int {
+	if workers < a.cfg.MinWorkers {
+		return a.cfg.MinWorkers
+	}
+	if workers > a.cfg.MaxWorkers {
+		return a.cfg.MaxWorkers
+	}
+	return workers
+}
+
+// run reconsiders the pool size every interval until the crawler stops
+func (a *autoscaler) run(ctx context.Context) {
+	c := a.crawler
+	defer c.wg.Done()
+
+	log.Printf("Autoscaling workers between %d and %d every %v", a.cfg.MinWorkers, a.cfg.MaxWorkers, a.cfg.Interval)
+	a.lastCheck = time.Now()
+	a.lastBusy = c.busyTime.Load()
+	a.lastFetchTime = c.fetchTime.Load()
+	a.lastFetchCount = c.fetchCount.Load()
+
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.check(ctx)
+		}
+	}
+}
+
+// check samples the crawler since the last check and resizes the pool if needed
+func (a *autoscaler) check(ctx context.Context) {
+	c := a.crawler
+
+	statsCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	queueStats, err := c.queue.Stats(statsCtx)
+	cancel()
+	if err != nil {
+		log.Printf("Autoscaler: Error getting queue stats: %v", err)
+		return
+	}
+
+	now := time.Now()
+	busy, fetchTime, fetchCount := c.busyTime.Load(), c.fetchTime.Load(), c.fetchCount.Load()
+	sample := autoscaleSample{
+		workers: c.WorkerCount(),
+		queue:   queueStats,
+	}
+	if elapsed := now.Sub(a.lastCheck); sample.workers > 0 && elapsed > 0 {
+		sample.utilization = float64(busy-a.lastBusy) / (float64(sample.workers) * float64(elapsed))
+	}
+	if fetches := fetchCount - a.lastFetchCount; fetches > 0 {
+		sample.latency = time.Duration((fetchTime - a.lastFetchTime) / fetches)
+	}
+	a.lastCheck, a.lastBusy, a.lastFetchTime, a.lastFetchCount = now, busy, fetchTime, fetchCount
+
+	target := a.target(sample)
+	if target == sample.workers {
+		return
+	}
+	log.Printf("Autoscaler: %d -> %d workers (utilization %.0f%%, latency %v, %d ready, %d paced)",
+		sample.workers, target, sample.utilization*100, sample.latency.Round(time.Millisecond),
+		sample.queue.Ready, sample.queue.Paced)
+	c.SetWorkerCount(target)
+}
+
+// target returns the pool size for a sample. The pool grows by a quarter while the
+// workers are saturated and more tasks can be fetched right away than there are
+// workers; it shrinks by a quarter when they are mostly idle or hosts slow down past
+// the target latency, since more workers would only add load.
+func (a *autoscaler) target(sample autoscaleSample) int {
+	step := sample.workers / 4
+	if step < 1 {
+		step = 1
+	}
+
+	// Tasks held back by host pacing can't use more workers
+	fetchable := sample.queue.Ready - sample.queue.Paced
+
+	workers := sample.workers
+	switch {
+	case a.cfg.TargetLatency > 0 && sample.latency > a.cfg.TargetLatency:
+		workers -= step
+	case sample.utilization < lowUtilization:
+		workers -= step
+	case sample.utilization > highUtilization && fetchable > sample.workers:
+		workers += step
+	}
+	return a.clamp(workers)
+}
@@ -0,0 +1,129 @@
+package crawler
+
+import (
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// defaultPorts are dropped from canonical URLs
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Canonicalizer rewrites URLs into a canonical form so that trivially
+// different spellings of the same page are deduplicated
+type Canonicalizer struct {
+	stripExact  map[string]struct{}
+	stripPrefix []string
+}
+
+// NewCanonicalizer creates a canonicalizer that removes the given query
+// parameters. A trailing "*" matches every parameter with that prefix (e.g. "utm_*").
+func NewCanonicalizer(stripParams []string) *Canonicalizer {
+	c := &Canonicalizer{stripExact: make(map[string]struct{})}
+	for _, param := range stripParams {
+		param = strings.ToLower(strings.TrimSpace(param))
+		if param == "" {
+			continue
+		}
+		if strings.HasSuffix(param, "*") {
+			c.stripPrefix = append(c.stripPrefix, strings.TrimSuffix(param, "*"))
+		} else {
+			c.stripExact[param] = struct{}{}
+		}
+	}
+	return c
+}
+
+// Canonicalize returns the canonical form of u: lower-cased scheme and host,
+// no default port, no fragment, "/" for an empty path and the query parameters
+// sorted by name with tracking parameters removed. u itself is not modified.
+func (c *Canonicalizer) Canonicalize(u *url.URL) *url.URL {
+	canonical := *u
+	canonical.Scheme = strings.ToLower(u.Scheme)
+	canonical.Fragment = ""
+	canonical.RawFragment = ""
+
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != defaultPorts[canonical.Scheme] {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6 literal without a port
+	}
+	canonical.Host = host
+
+	if canonical.Path == "" && canonical.Opaque == "" {
+		canonical.Path = "/"
+		canonical.RawPath = ""
+	}
+
+	canonical.RawQuery = c.canonicalQuery(u.RawQuery)
+	canonical.ForceQuery = false
+	return &canonical
+}
+
+// CanonicalizeString parses and canonicalizes a URL string
+func (c *Canonicalizer) CanonicalizeString(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return c.Canonicalize(u).String(), nil
+}
+
+// canonicalQuery sorts the query parameters by name, keeping the order of
+// repeated parameters and their original encoding, and drops stripped ones
+func (c *Canonicalizer) canonicalQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	type param struct {
+		name string
+		raw  string
+	}
+	var params []param
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		name := raw
+		if i := strings.Index(raw, "="); i >= 0 {
+			name = raw[:i]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if c.stripped(name) {
+			continue
+		}
+		params = append(params, param{name: name, raw: raw})
+	}
+
+	sort.SliceStable(params, func(i, j int) bool {
+		return params[i].name < params[j].name
+	})
+
+	raws := make([]string, len(params))
+	for i, p := range params {
+		raws[i] = p.raw
+	}
+	return strings.Join(raws, "&")
+}
+
+// stripped reports whether a query parameter is configured to be removed
+func (c *Canonicalizer) stripped(name string) bool {
+	name = strings.ToLower(name)
+	if _, ok := c.stripExact[name]; ok {
+		return true
+	}
+	for _, prefix := range c.stripPrefix {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -215,6 +215,20 @@ func (cb *CircuitBreaker) GetState(host string) string {
 	return circuit.state
 }
 
+// OpenCircuits returns the number of hosts whose circuit is open or half-open
+func (cb *CircuitBreaker) OpenCircuits() int {
+	cb.mu.RLock()
+	defer cb.mu.RUnlock()
+
+	open := 0
+	for _, circuit := range cb.hosts {
+		if circuit.state != circuitClosed {
+			open++
+		}
+	}
+	return open
+}
+
 // Reset resets the circuit for a host to closed state
 func (cb *CircuitBreaker) Reset(host string) {
 	cb.mu.Lock()
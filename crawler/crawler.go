@@ -2,16 +2,23 @@ package crawler
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	mathrand "math/rand"
 	"net/http"
 	"net/url"
-	"strings"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/MunishMummadi/web-scrapper/blobstore"
 	"github.com/MunishMummadi/web-scrapper/config"
 	"github.com/MunishMummadi/web-scrapper/database"
 	"github.com/MunishMummadi/web-scrapper/metrics"
@@ -22,8 +29,19 @@ import (
 // Crawler manages the crawling process
 type Crawler struct {
 	cfg            *config.CrawlerConfig
+	nodeID         string // Whose in-flight tasks this node counts in job progress
 	queue          queue.Queue
+	frontier       *queue.HostFrontier // Wraps queue when per-host scheduling is enabled
+	recrawler      *recrawlScheduler   // nil when adaptive recrawling is disabled
+	autoscaler     *autoscaler         // nil when the worker pool has a fixed size
+	retryPolicy    *retryPolicy
+	throttle       *autoThrottle // nil when per-host rates aren't adapted
+	deadLetters    queue.DeadLetterQueue
+	seen           queue.SeenSet
+	canonicalizer  *Canonicalizer
 	storage        database.Storage
+	decisions      *decisionLog
+	blobs          blobstore.Store // nil when body storage is disabled
 	httpClient     *http.Client
 	metrics        *metrics.MetricsCollector
 	robots         *RobotsCache
@@ -32,10 +50,34 @@ type Crawler struct {
 	proxyManager   *proxy.Manager
 	stopChan       chan struct{} // Channel to signal workers to stop
 	wg             sync.WaitGroup    // WaitGroup to wait for workers to finish
+
+	crawls   map[string]*crawlState // Active crawls by ID
+	crawlsMu sync.Mutex
+
+	settings         Settings // Options that can be changed at runtime, see UpdateSettings
+	settingsMu       sync.RWMutex
+	settingsUpdateMu sync.Mutex // Serializes UpdateSettings from reading the settings to applying them
+
+	workers    []chan struct{} // Quit channel of every worker in the pool
+	nextWorker int             // ID of the next worker launched
+	workerCtx  context.Context // Context passed to Start, for workers launched later
+	started    bool
+	stopped    bool
+	poolMu     sync.Mutex
+
+	fetches       *rateCounter // Successful fetches, for the crawl rate
+	fetchFailures *rateCounter // Failed fetch attempts, for the error rate
+	busy          atomic.Int64 // Workers handling a task
+	busyTime      atomic.Int64 // Nanoseconds workers spent handling tasks
+	fetchTime     atomic.Int64 // Nanoseconds spent waiting for responses
+	fetchCount    atomic.Int64 // Requests sent
+	running       atomic.Int64 // Worker goroutines alive, including removed ones finishing a task
+	startedAt     time.Time
+	statsMu       sync.Mutex
 }
 
 // NewCrawler creates a new Crawler instance
-func NewCrawler(cfg *config.Config, q queue.Queue, s database.Storage, m *metrics.MetricsCollector, p *proxy.Manager) (*Crawler, error) {
+func NewCrawler(cfg *config.Config, q queue.Queue, dlq queue.DeadLetterQueue, seen queue.SeenSet, rs RobotsStore, s database.Storage, b blobstore.Store, m *metrics.MetricsCollector, p *proxy.Manager) (*Crawler, error) {
 	// Configure HTTP client with proxy and timeouts
 	transport := p.GetTransport()
 	httpClient := &http.Client{
@@ -43,13 +85,20 @@ func NewCrawler(cfg *config.Config, q queue.Queue, s database.Storage, m *metric
 		Transport: transport,
 	}
 
-	// Create the robots.txt cache
-	robotsCache := NewRobotsCache(cfg.Crawler.UserAgent, httpClient)
+	// Create the robots.txt cache, backed by the shared store
+	robotsCache := NewRobotsCache(cfg.Crawler.UserAgent, httpClient, rs, cfg.Crawler.Robots)
 
 	// Create rate limiter (convert default delay to QPS)
 	defaultQPS := 1.0 / cfg.Crawler.DefaultDelay.Seconds()
 	rateLimiter := NewHostRateLimiter(defaultQPS, cfg.Crawler.MaxConcurrentHosts)
 
+	// Serve workers per host so they only get URLs the rate limiter lets through now
+	var frontier *queue.HostFrontier
+	if cfg.Crawler.HostFrontier {
+		frontier = queue.NewHostFrontier(q, rateLimiter, cfg.Redis.VisibilityTimeout)
+		q = frontier
+	}
+
 	// Create circuit breaker
 	circuitBreaker := NewCircuitBreaker(
 		cfg.Crawler.CircuitBreakerRatio,
@@ -59,44 +108,147 @@ func NewCrawler(cfg *config.Config, q queue.Queue, s database.Storage, m *metric
 		time.Hour, // Host error expiry
 	)
 
-	return &Crawler{
+	retryPolicy, err := newRetryPolicy(cfg.Crawler.RetryPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry policy: %w", err)
+	}
+
+	nodeID := cfg.Crawler.NodeID
+	if nodeID == "" {
+		if nodeID, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to get hostname for the node ID: %w", err)
+		}
+	}
+
+	c := &Crawler{
 		cfg:            &cfg.Crawler,
+		nodeID:         nodeID,
 		queue:          q,
+		frontier:       frontier,
+		deadLetters:    dlq,
+		seen:           seen,
+		canonicalizer:  NewCanonicalizer(cfg.Crawler.StripQueryParams),
 		storage:        s,
+		decisions:      newDecisionLog(s, cfg.Crawler.DecisionRetention),
+		blobs:          b,
 		httpClient:     httpClient,
 		metrics:        m,
 		robots:         robotsCache,
 		rateLimiter:    rateLimiter,
 		circuitBreaker: circuitBreaker,
+		retryPolicy:    retryPolicy,
 		proxyManager:   p,
 		stopChan:       make(chan struct{}),
-	}, nil
+		crawls:         make(map[string]*crawlState),
+		settings:       settingsFromConfig(&cfg.Crawler),
+		fetches:        newRateCounter(statsWindows[len(statsWindows)-1]),
+		fetchFailures:  newRateCounter(statsWindows[len(statsWindows)-1]),
+	}
+	if cfg.Crawler.Recrawl.Enabled {
+		c.recrawler = newRecrawlScheduler(c, cfg.Crawler.Recrawl, cfg.Crawler.CacheExpiration)
+	}
+	if cfg.Crawler.Throttle.AutoThrottle {
+		c.throttle = newAutoThrottle(rateLimiter, cfg.Crawler.Throttle)
+	}
+	if cfg.Crawler.Autoscale.Enabled {
+		c.autoscaler = newAutoscaler(c, cfg.Crawler.Autoscale)
+	}
+	return c, nil
 }
 
 // Start begins the crawling process by launching worker goroutines
 func (c *Crawler) Start(ctx context.Context) {
-	log.Printf("Starting %d crawler workers...", c.cfg.WorkerCount)
-	c.wg.Add(c.cfg.WorkerCount)
-	c.metrics.SetWorkersRunning(c.cfg.WorkerCount)
-	
-	for i := 0; i < c.cfg.WorkerCount; i++ {
-		go c.worker(ctx, i)
+	workers := c.Settings().WorkerCount
+	if c.autoscaler != nil {
+		workers = c.autoscaler.clamp(workers)
 	}
+	log.Printf("Starting %d crawler workers...", workers)
+	c.statsMu.Lock()
+	c.startedAt = time.Now()
+	c.statsMu.Unlock()
+
+	c.poolMu.Lock()
+	c.workerCtx = ctx
+	c.started = true
+	c.poolMu.Unlock()
+	c.SetWorkerCount(workers)
+
+	if c.recrawler != nil {
+		c.wg.Add(1)
+		go c.recrawler.run(ctx)
+	}
+	if c.autoscaler != nil {
+		c.wg.Add(1)
+		go c.autoscaler.run(ctx)
+	}
+	c.wg.Add(1)
+	go c.reportStats(ctx)
 	log.Println("Crawler started.")
 }
 
 // Stop signals the crawler workers to stop gracefully
 func (c *Crawler) Stop() {
 	log.Println("Stopping crawler workers...")
+	c.poolMu.Lock()
+	c.stopped = true // No workers are launched from now on
+	c.workers = nil
+	c.poolMu.Unlock()
 	close(c.stopChan) // Signal workers
 	c.wg.Wait()       // Wait for all workers to finish
-	c.metrics.SetWorkersRunning(0)
+	if c.frontier != nil {
+		// Hand tasks still buffered per host back to the queue
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		c.frontier.Release(ctx)
+		cancel()
+	}
+	c.decisions.close() // Write the decisions still buffered
 	log.Println("Crawler stopped.")
 }
 
-// worker is the main loop for a single crawler worker
-func (c *Crawler) worker(ctx context.Context, id int) {
-	defer c.wg.Done()
+// SetWorkerCount grows or shrinks the worker pool to n workers. A removed worker
+// finishes the task it is handling before it exits. It has no effect before Start,
+// which launches Settings().WorkerCount workers, or after Stop.
+func (c *Crawler) SetWorkerCount(n int) {
+	if n < 0 {
+		n = 0
+	}
+
+	c.poolMu.Lock()
+	defer c.poolMu.Unlock()
+	if !c.started || c.stopped || n == len(c.workers) {
+		return
+	}
+
+	log.Printf("Resizing worker pool from %d to %d workers", len(c.workers), n)
+	for len(c.workers) < n {
+		quit := make(chan struct{})
+		c.workers = append(c.workers, quit)
+		c.wg.Add(1)
+		go c.worker(c.workerCtx, c.nextWorker, quit)
+		c.nextWorker++
+	}
+	for len(c.workers) > n {
+		last := len(c.workers) - 1
+		close(c.workers[last])
+		c.workers = c.workers[:last]
+	}
+}
+
+// WorkerCount returns the number of workers in the pool, not counting removed
+// workers still finishing their task
+func (c *Crawler) WorkerCount() int {
+	c.poolMu.Lock()
+	defer c.poolMu.Unlock()
+	return len(c.workers)
+}
+
+// worker is the main loop for a single crawler worker, until quit is closed or the crawler stops
+func (c *Crawler) worker(ctx context.Context, id int, quit <-chan struct{}) {
+	c.metrics.SetWorkersRunning(int(c.running.Add(1)))
+	defer func() {
+		c.metrics.SetWorkersRunning(int(c.running.Add(-1)))
+		c.wg.Done()
+	}()
 	log.Printf("Worker %d started", id)
 
 	for {
@@ -104,13 +256,16 @@ func (c *Crawler) worker(ctx context.Context, id int) {
 		case <-c.stopChan: // Check if stop signal received
 			log.Printf("Worker %d stopping...", id)
 			return
+		case <-quit: // Removed from the pool
+			log.Printf("Worker %d removed from the pool, stopping...", id)
+			return
 		case <-ctx.Done(): // Check if context cancelled (e.g., application shutdown)
 			log.Printf("Worker %d stopping due to context cancellation...", id)
 			return
 		default:
-			// Attempt to dequeue a URL with a shorter timeout
+			// Attempt to dequeue a task with a shorter timeout
 			dequeueCtx, cancel := context.WithTimeout(ctx, 1*time.Second) // Reduced timeout for dequeue
-			urlToScrape, err := c.queue.Dequeue(dequeueCtx)
+			task, err := c.queue.Dequeue(dequeueCtx)
 			cancel()
 
 			if err != nil {
@@ -122,148 +277,408 @@ func (c *Crawler) worker(ctx context.Context, id int) {
 				continue
 			}
 
-			if urlToScrape == "" {
+			if task == nil {
 				// Queue is empty, wait a bit before polling again to avoid CPU spinning
 				time.Sleep(1 * time.Second)
 				continue
 			}
 
+			urlToScrape := task.URL
 			log.Printf("Worker %d: Dequeued URL: %s", id, urlToScrape)
+			c.metrics.RecordQueueLatency(queueLatency(task))
+
+			crawl := c.crawlForTask(ctx, task)
+			if !c.startTask(id, crawl, task) {
+				continue
+			}
 			
 			// Record the processing start time for metrics
 			startTime := time.Now()
 			
-			// Process URL with retry logic
-			success := false
-			var processErr error
-			
-			for retries := 0; retries <= c.cfg.MaxRetries; retries++ {
-				if retries > 0 {
-					log.Printf("Worker %d: Retry %d/%d for URL %s", id, retries, c.cfg.MaxRetries, urlToScrape)
-					// Exponential backoff
-					backoff := c.cfg.RetryDelay * time.Duration(1<<uint(retries-1))
-					time.Sleep(backoff)
-				}
-				
-				processErr = c.processURL(ctx, urlToScrape)
-				if processErr == nil {
-					success = true
-					break
-				}
-				
-				// Check for permanent errors (don't retry)
-				if strings.Contains(processErr.Error(), "robots.txt disallowed") ||
-				   strings.Contains(processErr.Error(), "invalid URL") {
-					break
+			task.Attempt++
+			c.busy.Add(1)
+			processErr := c.processURL(ctx, task)
+			c.busy.Add(-1)
+			c.busyTime.Add(int64(time.Since(startTime)))
+
+			var paused *hostPausedError
+			if errors.As(processErr, &paused) {
+				// Not an attempt, come back once the host is willing to answer again
+				task.Attempt--
+				log.Printf("Worker %d: %v, deferring URL %s", id, processErr, urlToScrape)
+				if c.requeue(id, task, paused.until) {
+					c.settle(id, task, true)
+				} else {
+					c.settle(id, task, false)
 				}
+				c.jobProgress(crawl, database.CrawlJobCounts{InFlight: -1, Queued: 1})
+				continue
 			}
 
 			// Record metrics
 			c.metrics.RecordProcessingTime(time.Since(startTime))
+			if !errors.Is(processErr, errRecentlyScraped) && ctx.Err() == nil {
+				c.recordFetch(processErr != nil)
+			}
 			
-			if !success {
-				log.Printf("Worker %d: Failed to process URL %s after retries: %v", id, urlToScrape, processErr)
-				c.metrics.IncrementScrapingErrors()
+			if processErr == nil || errors.Is(processErr, errRecentlyScraped) {
+				c.settle(id, task, true)
+				if processErr == nil {
+					c.jobProgress(crawl, database.CrawlJobCounts{InFlight: -1, Succeeded: 1})
+				} else {
+					c.jobProgress(crawl, database.CrawlJobCounts{InFlight: -1, Skipped: 1})
+				}
+				continue
+			}
+
+			if ctx.Err() != nil {
+				// Shutting down mid-fetch, hand the task back so another worker picks it up
+				c.settle(id, task, false)
+				c.jobProgress(crawl, database.CrawlJobCounts{InFlight: -1, Queued: 1})
+				continue
 			}
+
+			// Permanent errors and classes or statuses the policy doesn't retry go straight to the dead-letter queue
+			settings := c.Settings()
+			retries := c.retryPolicy.retries(processErr, settings.MaxRetries)
+			if task.Attempt <= retries {
+				c.scheduleRetry(id, task, processErr, settings.RetryDelay, retries)
+				c.jobProgress(crawl, database.CrawlJobCounts{InFlight: -1, Queued: 1})
+				continue
+			}
+
+			class := errorClassOf(processErr)
+			log.Printf("Worker %d: Failed to process URL %s after %d attempts (%s): %v", id, urlToScrape, task.Attempt, class, processErr)
+			c.metrics.IncrementScrapingErrors(class)
+			c.deadLetter(id, task, processErr)
+			c.settle(id, task, true)
+			c.jobProgress(crawl, database.CrawlJobCounts{InFlight: -1, Failed: 1})
+		}
+	}
+}
+
+// scheduleRetry re-enqueues a failed task to become due after an exponential,
+// jittered backoff, so the worker is free to fetch something else meanwhile.
+// The backoff is stretched to the host's Retry-After when it asked for longer.
+func (c *Crawler) scheduleRetry(id int, task *queue.Task, processErr error, retryDelay time.Duration, retries int) {
+	backoff := retryBackoff(retryDelay, task.Attempt)
+	if retryAfter := retryAfterOf(processErr); retryAfter > backoff {
+		backoff = retryAfter
+	}
+	log.Printf("Worker %d: Attempt %d/%d for URL %s failed (%v), retrying in %v",
+		id, task.Attempt, retries+1, task.URL, processErr, backoff.Round(time.Millisecond))
+
+	if !c.requeue(id, task, time.Now().Add(backoff)) {
+		// Could not schedule the retry, release the task so it isn't lost
+		c.settle(id, task, false)
+		return
+	}
+	c.metrics.IncrementRetries()
+	c.settle(id, task, true)
+}
+
+// requeue enqueues a copy of a dequeued task to become due at notBefore. The
+// caller still settles the original.
+func (c *Crawler) requeue(id int, task *queue.Task, notBefore time.Time) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	delayed := *task
+	delayed.NotBefore = notBefore
+	if err := c.queue.Enqueue(ctx, &delayed); err != nil {
+		log.Printf("Worker %d: Error requeueing URL %s: %v", id, task.URL, err)
+		return false
+	}
+	return true
+}
+
+// retryBackoff returns the delay before the next attempt: baseDelay doubled for
+// every attempt already made, with ±20% jitter so retries don't move in lockstep
+func retryBackoff(baseDelay time.Duration, attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	backoff := baseDelay * time.Duration(1<<uint(attempt-1))
+	jitter := 0.8 + 0.4*mathrand.Float64()
+	return time.Duration(float64(backoff) * jitter)
+}
+
+// queueLatency is how long a task waited in the queue after becoming due
+func queueLatency(task *queue.Task) time.Duration {
+	since := task.EnqueuedAt
+	if task.NotBefore.After(since) {
+		since = task.NotBefore
+	}
+	if since.IsZero() {
+		return 0
+	}
+	return time.Since(since)
+}
+
+// settle acknowledges a dequeued task, or releases it back to the queue when ack is false.
+// It uses a fresh context since it also runs while the crawler is shutting down.
+func (c *Crawler) settle(id int, task *queue.Task, ack bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var err error
+	if ack {
+		err = c.queue.Ack(ctx, task)
+	} else {
+		err = c.queue.Nack(ctx, task)
+	}
+	if err != nil {
+		log.Printf("Worker %d: Error settling task for URL %s: %v", id, task.URL, err)
+	}
+}
+
+// deadLetter moves a task that exhausted its retries to the dead-letter queue
+func (c *Crawler) deadLetter(id int, task *queue.Task, processErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	entry := queue.NewDeadLetter(task, processErr, statusCodeOf(processErr))
+	if err := c.deadLetters.Add(ctx, entry); err != nil {
+		log.Printf("Worker %d: Error dead-lettering URL %s: %v", id, task.URL, err)
+		return
+	}
+	c.metrics.IncrementDeadLetters()
+}
+
+// pushedBack slows a host down after it answered 429 or 503 and pauses it for
+// as long as its Retry-After header asks, which it returns
+func (c *Crawler) pushedBack(host string, resp *http.Response, defaultDelay time.Duration) time.Duration {
+	c.metrics.IncrementThrottledResponses()
+	if c.throttle != nil {
+		c.throttle.throttled(host, defaultDelay)
+	}
+
+	wait, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if !ok || wait <= 0 {
+		return 0
+	}
+	if limit := c.cfg.Throttle.MaxRetryAfter; limit > 0 && wait > limit {
+		wait = limit
+	}
+	c.rateLimiter.Pause(host, time.Now().Add(wait))
+	log.Printf("%s answered %d, pausing it for %v as asked by Retry-After", host, resp.StatusCode, wait)
+	return wait
+}
+
+// followRobotsDirectives applies the Crawl-delay of the task's host, bounded by the
+// configured minimum and maximum, and enqueues the Sitemap URLs of its robots.txt
+// the first time the host is seen
+func (c *Crawler) followRobotsDirectives(ctx context.Context, task *queue.Task, host string) {
+	delay, ok := c.robots.CrawlDelay(task.URL)
+	if ok {
+		if delay < c.cfg.Robots.MinCrawlDelay {
+			delay = c.cfg.Robots.MinCrawlDelay
+		}
+		if limit := c.cfg.Robots.MaxCrawlDelay; limit > 0 && delay > limit {
+			delay = limit
 		}
 	}
+	c.rateLimiter.SetCrawlDelay(host, delay)
+
+	if !c.cfg.Robots.EnqueueSitemaps {
+		return
+	}
+	sitemaps := c.robots.NewSitemaps(task.URL)
+	if len(sitemaps) == 0 {
+		return
+	}
+
+	// Sitemaps join the crawl of the task that found the host, at the depth of that task
+	crawl := c.crawlForTask(ctx, task)
+	enqueued := 0
+	for _, sitemap := range sitemaps {
+		sitemapURL, err := url.Parse(sitemap)
+		if err != nil || (sitemapURL.Scheme != "http" && sitemapURL.Scheme != "https") {
+			continue
+		}
+		ok, err := c.enqueueInCrawl(ctx, crawl, sitemapURL, task.URL, task.Depth, false, &sitemapEntry{loc: sitemap, sitemap: true})
+		if err != nil {
+			log.Printf("Error enqueuing sitemap %s: %v", sitemap, err)
+			continue
+		}
+		if ok {
+			enqueued++
+		}
+	}
+	log.Printf("Found %d sitemaps in robots.txt of %s, enqueued %d", len(sitemaps), host, enqueued)
+}
+
+// recordHostFailure counts a failed fetch against the host's circuit when the error
+// points at the host, e.g. a timeout or a 503 but not a 404
+func (c *Crawler) recordHostFailure(host string, fetchErr *FetchError) {
+	if fetchErr.hostFault() {
+		c.circuitBreaker.RecordFailure(host)
+	}
 }
 
 // processURL handles the scraping of a single URL
-func (c *Crawler) processURL(ctx context.Context, urlStr string) error {
+func (c *Crawler) processURL(ctx context.Context, task *queue.Task) error {
+	settings := c.Settings() // Settings changed meanwhile apply from the next task
+	urlStr := task.URL
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
-		return fmt.Errorf("invalid URL: %w", err)
+		return policyError(true, fmt.Errorf("invalid URL: %w", err))
 	}
 	host := parsedURL.Hostname()
 
-	// Check cache for recent scrapes
-	lastScrape, err := c.storage.GetLastScrapeTime(ctx, urlStr)
-	if err == nil && time.Since(lastScrape) < c.cfg.CacheExpiration {
-		log.Printf("URL %s was recently scraped (%v ago), skipping", urlStr, time.Since(lastScrape))
-		return nil
+	// Check cache for recent scrapes, unless the recrawl scheduler decided the page is due
+	page, err := c.storage.GetPage(ctx, urlStr)
+	scraped := err == nil && !task.Sitemap // Sitemaps are expanded, never stored as pages
+	if scraped && !task.Recrawl && time.Since(page.ScrapedAt) < c.cfg.CacheExpiration {
+		log.Printf("URL %s was recently scraped (%v ago), skipping", urlStr, time.Since(page.ScrapedAt))
+		return errRecentlyScraped
+	}
+	if scraped && unchangedSince(page, task) {
+		log.Printf("URL %s is unchanged since it was scraped according to its sitemap (lastmod %v), skipping", urlStr, task.LastMod)
+		return errRecentlyScraped
 	}
 
 	// Check if circuit breaker is open for this host
 	if !c.circuitBreaker.IsAllowed(host) {
 		log.Printf("Circuit breaker is open for %s, skipping", host)
-		return fmt.Errorf("circuit breaker open for host %s", host)
+		return policyError(false, fmt.Errorf("circuit breaker open for host %s", host))
 	}
 
 	// Respect robots.txt 
-	if c.cfg.RespectRobots {
+	if settings.RespectRobots {
 		allowed, err := c.robots.IsAllowed(urlStr)
-		if err != nil {
+		var unavailable *robotsUnavailableError
+		if errors.As(err, &unavailable) {
+			// Not a Disallow rule: hold the host's tasks back until robots.txt is fetched again
+			log.Printf("URL %s deferred: %v", urlStr, unavailable)
+			return &hostPausedError{host: host, until: unavailable.until}
+		} else if err != nil {
 			log.Printf("Error checking robots.txt for %s: %v", urlStr, err)
 			// Continue with caution
-		} else if !allowed {
-			log.Printf("URL %s is disallowed by robots.txt", urlStr)
-			c.metrics.IncrementRobotsDisallowed()
-			return fmt.Errorf("robots.txt disallowed URL %s", urlStr)
+		} else {
+			c.followRobotsDirectives(ctx, task, host)
+			if !allowed {
+				log.Printf("URL %s is disallowed by robots.txt", urlStr)
+				c.metrics.IncrementRobotsDisallowed()
+				return policyError(true, fmt.Errorf("robots.txt disallowed URL %s", urlStr))
+			}
 		}
 	}
 
+	// A host that sent a Retry-After longer than we would wait gets the task back later
+	if until := c.rateLimiter.PausedUntil(host); time.Until(until) > c.cfg.RequestTimeout {
+		return &hostPausedError{host: host, until: until}
+	}
+
 	// Apply rate limiting for the host
 	limiterCtx, cancel := context.WithTimeout(ctx, c.cfg.RequestTimeout)
 	defer cancel()
 	
 	if err := c.rateLimiter.Wait(limiterCtx, host); err != nil {
-		return fmt.Errorf("rate limiting wait failed: %w", err)
+		return &FetchError{Class: ClassTimeout, Err: fmt.Errorf("rate limiting wait failed: %w", err)}
 	}
 
 	// Create and execute the HTTP request
 	log.Printf("Fetching %s...", urlStr)
 	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return policyError(true, fmt.Errorf("failed to create request: %w", err))
+	}
+	req.Header.Set("User-Agent", settings.UserAgent)
+
+	// Revalidate pages we already have instead of downloading them again
+	if scraped && page.ContentHash != "" {
+		if page.ETag != "" {
+			req.Header.Set("If-None-Match", page.ETag)
+		}
+		if page.LastModified != "" {
+			req.Header.Set("If-Modified-Since", page.LastModified)
+		}
 	}
-	req.Header.Set("User-Agent", c.cfg.UserAgent)
 
 	startTime := time.Now()
 	resp, err := c.httpClient.Do(req)
 	requestDuration := time.Since(startTime)
 	c.metrics.RecordScrapingDuration(requestDuration)
+	c.fetchTime.Add(int64(requestDuration))
+	c.fetchCount.Add(1)
 
 	if err != nil {
-		c.circuitBreaker.RecordFailure(host)
+		fetchErr := classifyError(fmt.Errorf("http request failed: %w", err))
+		c.recordHostFailure(host, fetchErr)
 		// If using proxy, record the failure
 		if c.proxyManager != nil {
 			proxyURL := req.URL.String() // This is not correct in all cases, but a simplification
 			c.proxyManager.RecordFailure(proxyURL)
 			c.metrics.IncrementProxyFailures()
 		}
-		return fmt.Errorf("http request failed: %w", err)
+		return fetchErr
 	}
 	defer resp.Body.Close()
 
 	log.Printf("Successfully fetched %s (%d) in %v", urlStr, resp.StatusCode, requestDuration)
 
+	if c.throttle != nil && resp.StatusCode < 400 {
+		c.throttle.observe(host, requestDuration, c.rateLimiter.BaseInterval(host))
+	}
+
+	if resp.StatusCode == http.StatusNotModified && scraped {
+		c.handleNotModified(ctx, task, page, resp)
+		return nil
+	}
+
 	// Handle non-success status codes
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		c.circuitBreaker.RecordFailure(host)
-		return fmt.Errorf("received non-2xx status code: %d", resp.StatusCode)
+		fetchErr := statusError(resp.StatusCode)
+		if isThrottling(resp.StatusCode) {
+			fetchErr.RetryAfter = c.pushedBack(host, resp, c.rateLimiter.BaseInterval(host))
+		}
+		c.recordHostFailure(host, fetchErr)
+		c.recordVersion(ctx, urlStr, resp, "", 0)
+		return fetchErr
+	}
+
+	if task.Sitemap {
+		if err := c.expandSitemap(ctx, task, resp); err != nil {
+			var fetchErr *FetchError
+			if errors.As(err, &fetchErr) {
+				c.recordHostFailure(host, fetchErr)
+			}
+			return err
+		}
+		c.circuitBreaker.RecordSuccess(host)
+		return nil
 	}
 
 	// Read and process response body
 	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, 10*1024*1024)) // Limit to 10MB
 	if err != nil {
-		c.circuitBreaker.RecordFailure(host)
-		return fmt.Errorf("failed to read response body: %w", err)
+		fetchErr := classifyError(fmt.Errorf("failed to read response body: %w", err))
+		c.recordHostFailure(host, fetchErr)
+		return fetchErr
 	}
 
 	// Record response size metric
 	c.metrics.RecordResponseSize(float64(len(bodyBytes)))
 
-	// Calculate content hash
-	hasher := sha256.New()
-	hasher.Write(bodyBytes)
-	contentHash := fmt.Sprintf("%x", hasher.Sum(nil))
+	// Honour noindex and nofollow from the X-Robots-Tag header and the page's meta tags
+	agent := agentToken(settings.UserAgent)
+	isHTML := isHTMLContent(resp.Header.Get("Content-Type"))
+	var parsed parsedPage
+	if isHTML {
+		// Resolve against the final URL in case we were redirected
+		parsed = parsePage(resp.Request.URL, bodyBytes, agent)
+	}
+	var robots robotsDirectives
+	if settings.RespectRobots {
+		robots = c.pageRobots(urlStr, resp, parsed, agent)
+	}
 
-	// Save scrape result to storage
-	scrapedAt := time.Now()
-	if err := c.storage.SaveScrapedData(ctx, urlStr, scrapedAt, contentHash); err != nil {
-		log.Printf("Error saving scrape data for %s: %v", urlStr, err)
-		// Not a fatal error, continue
+	changed := false
+	if !robots.noindex {
+		changed = c.storePage(ctx, urlStr, resp, bodyBytes)
+	} else if scraped {
+		c.dropPage(ctx, urlStr)
 	}
 
 	// Record success in circuit breaker
@@ -278,13 +693,408 @@ func (c *Crawler) processURL(ctx context.Context, urlStr string) error {
 	// Increment successful scrapes counter
 	c.metrics.IncrementScrapedPages()
 
+	if c.recrawler != nil {
+		c.recrawler.observe(ctx, urlStr, changed)
+	}
+
+	// Expand the frontier with the links found on the page. Recrawls only
+	// refresh pages that are already known.
+	if !task.Recrawl && isHTML && !robots.nofollow {
+		c.enqueueLinks(ctx, task, resp.Request.URL, parsed, settings.RespectRobots)
+	}
+
 	return nil
 }
 
-// EnqueueURL adds a URL to the queue for crawling
+// storePage keeps a fetched body, its version and the page's scrape data. It
+// reports whether the content changed since the previous version.
+func (c *Crawler) storePage(ctx context.Context, urlStr string, resp *http.Response, bodyBytes []byte) bool {
+	// Calculate content hash
+	hasher := sha256.New()
+	hasher.Write(bodyBytes)
+	contentHash := fmt.Sprintf("%x", hasher.Sum(nil))
+
+	// Keep the body itself, identical bodies are only stored once
+	if c.blobs != nil {
+		if err := c.blobs.Put(ctx, contentHash, bodyBytes); err != nil {
+			log.Printf("Error storing body of %s: %v", urlStr, err)
+			// Not a fatal error, continue
+		}
+	}
+
+	// Keep the fetch in the page's history, flagging content changes
+	changed := c.recordVersion(ctx, urlStr, resp, contentHash, len(bodyBytes))
+
+	// Save scrape result to storage
+	if err := c.storage.SaveScrapedData(ctx, database.Page{
+		URL:          urlStr,
+		ScrapedAt:    time.Now(),
+		ContentHash:  contentHash,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}); err != nil {
+		log.Printf("Error saving scrape data for %s: %v", urlStr, err)
+		// Not a fatal error, continue
+	}
+	return changed
+}
+
+// handleNotModified completes a recrawl the server answered with 304: the stored
+// copy is still current, so only its scrape time and validators are refreshed
+func (c *Crawler) handleNotModified(ctx context.Context, task *queue.Task, page database.Page, resp *http.Response) {
+	log.Printf("URL %s not modified since %v", page.URL, page.ScrapedAt)
+
+	c.circuitBreaker.RecordSuccess(resp.Request.URL.Hostname())
+	c.metrics.IncrementNotModified()
+
+	// The content didn't change, but the page may no longer want it indexed
+	settings := c.Settings()
+	agent := agentToken(settings.UserAgent)
+	if settings.RespectRobots && parseRobotsHeader(resp.Header, agent).noindex {
+		log.Printf("URL %s is marked noindex, not storing its content", page.URL)
+		c.metrics.IncrementRobotsSuppressed("noindex", robotsSourceHeader)
+		c.dropPage(ctx, page.URL)
+		if c.recrawler != nil {
+			c.recrawler.observe(ctx, page.URL, false)
+		}
+		return
+	}
+
+	c.recordVersion(ctx, page.URL, resp, "", 0)
+
+	// A 304 may carry updated validators
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		page.ETag = etag
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		page.LastModified = lastModified
+	}
+	page.ScrapedAt = time.Now()
+	if err := c.storage.SaveScrapedData(ctx, page); err != nil {
+		log.Printf("Error saving scrape data for %s: %v", page.URL, err)
+	}
+	if c.recrawler != nil {
+		c.recrawler.observe(ctx, page.URL, false)
+	}
+
+	// The links haven't changed either, but this crawl may not have followed
+	// them yet; take them from the stored body when we have it
+	if c.blobs == nil || task.Recrawl {
+		return
+	}
+	body, err := c.blobs.Get(ctx, page.ContentHash)
+	if err != nil {
+		if !errors.Is(err, blobstore.ErrNotFound) {
+			log.Printf("Error loading stored body of %s: %v", page.URL, err)
+		}
+		return
+	}
+	if isHTMLContent(http.DetectContentType(body)) {
+		parsed := parsePage(resp.Request.URL, body, agent)
+		if settings.RespectRobots && c.pageRobots(page.URL, resp, parsed, agent).nofollow {
+			return
+		}
+		c.enqueueLinks(ctx, task, resp.Request.URL, parsed, settings.RespectRobots)
+	}
+}
+
+// recordVersion adds a fetch to the page's version history and reports content changes.
+// It returns whether the content differs from the previous version.
+func (c *Crawler) recordVersion(ctx context.Context, urlStr string, resp *http.Response, contentHash string, size int) bool {
+	headers := resp.Header.Clone()
+	headers.Del("Set-Cookie") // Don't persist session cookies
+
+	version, err := c.storage.SavePageVersion(ctx, database.PageVersion{
+		URL:         urlStr,
+		FetchedAt:   time.Now(),
+		StatusCode:  resp.StatusCode,
+		ContentHash: contentHash,
+		Size:        size,
+		Headers:     headers,
+	})
+	if err != nil {
+		log.Printf("Error saving version of %s: %v", urlStr, err)
+		return false
+	}
+	if version.Changed {
+		log.Printf("Content of %s changed (version %d)", urlStr, version.ID)
+		c.metrics.IncrementPageChanges()
+	}
+	return version.Changed
+}
+
+// enqueueLinks feeds the links of a fetched HTML page that the crawl's depth, budget
+// and scope rules admit back into the queue. Links marked rel="nofollow" are only
+// followed when robots directives are not respected.
+func (c *Crawler) enqueueLinks(ctx context.Context, task *queue.Task, pageURL *url.URL, parsed parsedPage, respectRobots bool) {
+	links := parsed.links
+	if respectRobots {
+		for range parsed.nofollowLinks {
+			c.metrics.IncrementRobotsSuppressed("nofollow", robotsSourceLink)
+		}
+	} else {
+		links = append(links, parsed.nofollowLinks...)
+	}
+	if len(links) == 0 {
+		return
+	}
+
+	crawl := c.crawlForTask(ctx, task)
+
+	enqueued := 0
+	for _, link := range links {
+		linkURL, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		ok, err := c.enqueueInCrawl(ctx, crawl, linkURL, task.URL, task.Depth+1, false, nil)
+		if err != nil {
+			log.Printf("Error enqueuing discovered link %s: %v", link, err)
+			continue
+		}
+		if ok {
+			enqueued++
+		}
+	}
+	log.Printf("Discovered %d links on %s, enqueued %d", len(links), pageURL, enqueued)
+}
+
+// StartCrawl registers a new crawl with the given options, records it as a job
+// and enqueues its seeds. It returns the crawl ID, which is also the job ID,
+// that every URL discovered from these seeds is tracked under.
+func (c *Crawler) StartCrawl(ctx context.Context, seeds []string, opts CrawlOptions) (string, error) {
+	return c.startCrawl(ctx, seeds, opts, false)
+}
+
+// startCrawl starts a crawl job from seed pages, or from sitemaps to expand
+func (c *Crawler) startCrawl(ctx context.Context, seeds []string, opts CrawlOptions, sitemaps bool) (string, error) {
+	seedURLs := make([]*url.URL, 0, len(seeds))
+	for _, seed := range seeds {
+		seedURL, err := url.Parse(seed)
+		if err != nil || (seedURL.Scheme != "http" && seedURL.Scheme != "https") || seedURL.Host == "" {
+			return "", fmt.Errorf("invalid URL: %s", seed)
+		}
+		seedURLs = append(seedURLs, c.canonicalizer.Canonicalize(seedURL))
+	}
+	if len(seedURLs) == 0 {
+		return "", fmt.Errorf("at least one seed URL is required")
+	}
+
+	crawl, err := newCrawlState(newCrawlID(), opts, seedURLs)
+	if err != nil {
+		return "", err
+	}
+	crawl.job = true
+	crawl.status = JobRunning
+	crawl.seeding = true
+	crawl = c.registerCrawl(crawl)
+
+	if err := c.createJob(ctx, crawl, seedURLs); err != nil {
+		return crawl.id, err
+	}
+	defer func() {
+		// Seeds may have been fetched already, or none admitted at all
+		crawl.seeded()
+		c.jobProgress(crawl, database.CrawlJobCounts{})
+	}()
+
+	for _, seedURL := range seedURLs {
+		var entry *sitemapEntry
+		if sitemaps {
+			entry = &sitemapEntry{loc: seedURL.String(), sitemap: true}
+		}
+		if _, err := c.enqueueInCrawl(ctx, crawl, seedURL, "", 0, true, entry); err != nil {
+			return crawl.id, err
+		}
+	}
+	return crawl.id, nil
+}
+
+// enqueueInCrawl applies the crawl's rules to a URL, records the decision and
+// enqueues it when admitted. URLs found in a sitemap carry its entry, they are
+// enqueued at the sitemap priority unless they are seeds. It reports whether the
+// URL was enqueued.
+func (c *Crawler) enqueueInCrawl(ctx context.Context, crawl *crawlState, u *url.URL, parent string, depth int, seed bool, entry *sitemapEntry) (bool, error) {
+	u = c.canonicalizer.Canonicalize(u)
+	urlStr := u.String()
+	c.refreshJobStatus(crawl)
+	if crawl.jobStatus() == JobCancelled {
+		c.recordDecision(ctx, crawl.id, urlStr, parent, depth, DecisionDropped, ReasonJobCancelled)
+		return false, nil
+	}
+	decision, reason := crawl.admit(u, depth, seed)
+	if decision != DecisionEnqueued {
+		c.recordDecision(ctx, crawl.id, urlStr, parent, depth, decision, reason)
+		return false, nil
+	}
+
+	// Only URLs the crawl accepts are marked as seen, so a crawl with a wider
+	// scope can still pick up what another crawl dropped. Seeds are enqueued
+	// even when seen, so a site can be crawled again on request or schedule.
+	fresh, err := c.seen.Add(ctx, urlStr)
+	if err != nil {
+		log.Printf("Error checking seen-set for %s: %v", urlStr, err)
+	} else if !fresh && !seed {
+		crawl.release(u)
+		c.recordDecision(ctx, crawl.id, urlStr, parent, depth, DecisionDropped, ReasonDuplicate)
+		return false, nil
+	}
+
+	task := queue.NewTask(urlStr)
+	task.Depth = depth
+	task.ParentURL = parent
+	task.CrawlID = crawl.id
+	task.Priority = crawl.opts.LinkPriority
+	if entry != nil {
+		task.Priority = queue.PrioritySitemap
+		task.Sitemap = entry.sitemap
+		task.LastMod = entry.lastMod
+		task.SitemapPriority = entry.priority
+	}
+	if seed {
+		task.Priority = crawl.opts.Priority
+	}
+
+	if err := c.EnqueueTask(ctx, task); err != nil {
+		crawl.release(u)
+		if fresh {
+			c.forget(urlStr)
+		}
+		c.recordDecision(ctx, crawl.id, urlStr, parent, depth, DecisionDropped, ReasonEnqueueFailed)
+		return false, err
+	}
+
+	c.jobProgress(crawl, database.CrawlJobCounts{Queued: 1})
+	c.recordDecision(ctx, crawl.id, urlStr, parent, depth, decision, reason)
+	return true, nil
+}
+
+// crawlForTask returns the crawl a dequeued task belongs to. Jobs that are not
+// tracked in memory, e.g. started before a restart, are restored from storage.
+// Other crawls unknown here, e.g. started by another process, are recreated
+// under the same ID with the default options and the task's URL as seed.
+// Tasks without a crawl ID (bare URLs) become the seed of a fresh crawl.
+func (c *Crawler) crawlForTask(ctx context.Context, task *queue.Task) *crawlState {
+	crawlID := task.CrawlID
+	if crawlID != "" {
+		crawl, err := c.loadCrawl(ctx, crawlID)
+		if err == nil {
+			return crawl
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error restoring crawl %s: %v", crawlID, err)
+		}
+	} else {
+		crawlID = newCrawlID()
+		task.CrawlID = crawlID
+	}
+
+	var seeds []*url.URL
+	if u, err := url.Parse(task.URL); err == nil {
+		seeds = append(seeds, u)
+	}
+	crawl, err := newCrawlState(crawlID, DefaultCrawlOptions(c.cfg), seeds)
+	if err != nil {
+		// The configured defaults are invalid, fall back to a seed-only crawl
+		log.Printf("Invalid default crawl options: %v", err)
+		crawl, _ = newCrawlState(crawlID, CrawlOptions{}, seeds)
+	}
+	return c.registerCrawl(crawl)
+}
+
+// registerCrawl tracks a crawl and forgets crawls that have been idle for too long.
+// If a crawl with the same ID is already registered, that one is returned instead.
+func (c *Crawler) registerCrawl(crawl *crawlState) *crawlState {
+	c.crawlsMu.Lock()
+	defer c.crawlsMu.Unlock()
+
+	cutoff := time.Now().Add(-crawlIdleExpiry)
+	for id, existing := range c.crawls {
+		if existing.idleSince().Before(cutoff) {
+			delete(c.crawls, id)
+		}
+	}
+	if existing, ok := c.crawls[crawl.id]; ok {
+		return existing
+	}
+	c.crawls[crawl.id] = crawl
+	return crawl
+}
+
+// trackCrawl registers a crawl, replacing any crawl tracked under the same ID,
+// e.g. one recreated with default options after the crawl had gone idle
+func (c *Crawler) trackCrawl(crawl *crawlState) {
+	c.crawlsMu.Lock()
+	defer c.crawlsMu.Unlock()
+	c.crawls[crawl.id] = crawl
+}
+
+// recordDecision logs and counts a frontier decision and queues it to be persisted
+func (c *Crawler) recordDecision(ctx context.Context, crawlID, urlStr, parent string, depth int, decision, reason string) {
+	c.metrics.RecordFrontierDecision(decision, reason)
+	if decision == DecisionDropped {
+		log.Printf("Dropped %s (crawl %s, depth %d): %s", urlStr, crawlID, depth, reason)
+	}
+
+	c.decisions.add(database.URLDecision{
+		CrawlID:   crawlID,
+		URL:       urlStr,
+		ParentURL: parent,
+		Depth:     depth,
+		Decision:  decision,
+		Reason:    reason,
+		DecidedAt: time.Now(),
+	})
+}
+
+// newCrawlID generates a random identifier for a crawl
+func newCrawlID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// EnqueueURL canonicalizes a bare URL and adds it to the queue for crawling.
+// It returns ErrDuplicateURL if the URL was already enqueued recently.
 func (c *Crawler) EnqueueURL(ctx context.Context, urlStr string) error {
-	if err := c.queue.Enqueue(ctx, urlStr); err != nil {
-		return fmt.Errorf("failed to enqueue URL %s: %w", urlStr, err)
+	canonical, err := c.canonicalizer.CanonicalizeString(urlStr)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	fresh, err := c.seen.Add(ctx, canonical)
+	if err != nil {
+		log.Printf("Error checking seen-set for %s: %v", canonical, err)
+	} else if !fresh {
+		return ErrDuplicateURL
+	}
+
+	if err := c.EnqueueTask(ctx, queue.NewTask(canonical)); err != nil {
+		c.forget(canonical)
+		return err
+	}
+	return nil
+}
+
+// forget removes a URL that never made it onto the queue from the seen-set
+func (c *Crawler) forget(urlStr string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.seen.Remove(ctx, urlStr); err != nil {
+		log.Printf("Error removing %s from seen-set: %v", urlStr, err)
+	}
+}
+
+// EnqueueTask adds a task to the queue for crawling as is, without
+// canonicalization or the seen-set check, e.g. to replay dead-lettered tasks
+func (c *Crawler) EnqueueTask(ctx context.Context, task *queue.Task) error {
+	if task.EnqueuedAt.IsZero() {
+		task.EnqueuedAt = time.Now()
+	}
+	if err := c.queue.Enqueue(ctx, task); err != nil {
+		return fmt.Errorf("failed to enqueue URL %s: %w", task.URL, err)
 	}
 	c.metrics.IncrementQueuedURLs()
 	return nil
@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/database"
+)
+
+const (
+	decisionBuffer     = 10000       // Decisions waiting to be written before new ones are dropped
+	decisionBatchSize  = 500         // Decisions written per transaction
+	decisionFlushEvery = time.Second // Longest a decision waits to be written
+	decisionPruneEvery = time.Hour   // How often decisions past the retention are deleted
+)
+
+// decisionLog persists frontier decisions in batches from a goroutine of its own,
+// so workers never wait on a storage write per discovered link. When storage falls
+// behind and the buffer is full, decisions are dropped rather than blocking workers.
+type decisionLog struct {
+	storage   database.Storage
+	retention time.Duration // 0 keeps decisions forever
+	pending   chan database.URLDecision
+	dropped   atomic.Int64 // Decisions dropped since the last flush
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// newDecisionLog starts writing decisions to storage until close is called
+func newDecisionLog(storage database.Storage, retention time.Duration) *decisionLog {
+	l := &decisionLog{
+		storage:   storage,
+		retention: retention,
+		pending:   make(chan database.URLDecision, decisionBuffer),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// add queues a decision to be written without blocking
+func (l *decisionLog) add(decision database.URLDecision) {
+	select {
+	case l.pending <- decision:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// close writes the decisions still buffered and stops the log
+func (l *decisionLog) close() {
+	close(l.stop)
+	<-l.done
+}
+
+func (l *decisionLog) run() {
+	defer close(l.done)
+
+	flush := time.NewTicker(decisionFlushEvery)
+	defer flush.Stop()
+	prune := time.NewTicker(decisionPruneEvery)
+	defer prune.Stop()
+
+	l.prune()
+	batch := make([]database.URLDecision, 0, decisionBatchSize)
+	for {
+		select {
+		case decision := <-l.pending:
+			batch = append(batch, decision)
+			if len(batch) >= decisionBatchSize {
+				batch = l.write(batch)
+			}
+		case <-flush.C:
+			batch = l.write(batch)
+		case <-prune.C:
+			l.prune()
+		case <-l.stop:
+			for {
+				select {
+				case decision := <-l.pending:
+					batch = append(batch, decision)
+					if len(batch) >= decisionBatchSize {
+						batch = l.write(batch)
+					}
+				default:
+					l.write(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// write saves a batch and returns it emptied for reuse
+func (l *decisionLog) write(batch []database.URLDecision) []database.URLDecision {
+	if dropped := l.dropped.Swap(0); dropped > 0 {
+		log.Printf("Dropped %d frontier decisions, storage is falling behind", dropped)
+	}
+	if len(batch) == 0 {
+		return batch
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := l.storage.SaveURLDecisions(ctx, batch); err != nil {
+		log.Printf("Error saving %d frontier decisions: %v", len(batch), err)
+	}
+	return batch[:0]
+}
+
+// prune deletes the decisions older than the retention
+func (l *decisionLog) prune() {
+	if l.retention <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	deleted, err := l.storage.PruneURLDecisions(ctx, time.Now().Add(-l.retention))
+	if err != nil {
+		log.Printf("Error pruning frontier decisions: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Pruned %d frontier decisions older than %v", deleted, l.retention)
+	}
+}
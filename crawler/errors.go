@@ -0,0 +1,153 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ErrDuplicateURL is returned by EnqueueURL for URLs that were already enqueued recently
+var ErrDuplicateURL = errors.New("URL already seen")
+
+// ErrJobNotFound is returned by the job controls for unknown job IDs
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobState is returned when a job can't be paused, resumed or cancelled in its current status
+var ErrJobState = errors.New("invalid job state")
+
+// errRecentlyScraped is returned by processURL for pages skipped because they were scraped recently
+// or haven't changed since, according to their sitemap
+var errRecentlyScraped = errors.New("recently scraped")
+
+// StatusError reports that a page was fetched but answered with a non-2xx status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("received non-2xx status code: %d", e.StatusCode)
+}
+
+// statusCodeOf returns the HTTP status code carried by err, or 0 if there is none
+func statusCodeOf(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
+// ErrorClass groups failed fetches by cause, for retry decisions and metrics
+type ErrorClass string
+
+const (
+	ClassNetwork    ErrorClass = "network"     // Connection refused or reset, broken transfers
+	ClassDNS        ErrorClass = "dns"         // Host name lookups
+	ClassTLS        ErrorClass = "tls"         // Handshakes and certificate verification
+	ClassTimeout    ErrorClass = "timeout"     // Requests or rate limiter waits that ran out of time
+	ClassHTTPStatus ErrorClass = "http_status" // Responses with a non-2xx status
+	ClassPolicy     ErrorClass = "policy"      // URLs refused by the crawler itself: invalid, robots.txt, open circuit
+)
+
+// errorClasses lists every error class
+var errorClasses = []ErrorClass{ClassNetwork, ClassDNS, ClassTLS, ClassTimeout, ClassHTTPStatus, ClassPolicy}
+
+// FetchError is returned by processURL when a URL could not be fetched. Permanent
+// errors, such as an invalid URL or a host name that doesn't exist, are never retried;
+// whether the others are is up to the retry policy.
+type FetchError struct {
+	Class      ErrorClass
+	StatusCode int           // Response status for ClassHTTPStatus
+	RetryAfter time.Duration // How long the host asked to wait before retrying
+	Permanent  bool
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// hostFault reports whether the error says the host is struggling, which is what
+// the circuit breaker counts. A 404 or a robots.txt rule doesn't.
+func (e *FetchError) hostFault() bool {
+	switch e.Class {
+	case ClassNetwork, ClassDNS, ClassTLS, ClassTimeout:
+		return true
+	case ClassHTTPStatus:
+		return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout
+	}
+	return false
+}
+
+// policyError returns a FetchError for a URL the crawler refused to fetch
+func policyError(permanent bool, err error) *FetchError {
+	return &FetchError{Class: ClassPolicy, Permanent: permanent, Err: err}
+}
+
+// statusError returns a FetchError for a response with a non-2xx status
+func statusError(statusCode int) *FetchError {
+	return &FetchError{Class: ClassHTTPStatus, StatusCode: statusCode, Err: &StatusError{StatusCode: statusCode}}
+}
+
+// classifyError returns a FetchError for an error from sending a request or reading its response
+func classifyError(err error) *FetchError {
+	fetchErr := &FetchError{Class: ClassNetwork, Err: err}
+
+	var dnsErr *net.DNSError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		fetchErr.Class = ClassDNS
+		fetchErr.Permanent = dnsErr.IsNotFound // NXDOMAIN
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr),
+		errors.As(err, &invalidCert), errors.As(err, &recordErr), errors.As(err, &alertErr):
+		fetchErr.Class = ClassTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		fetchErr.Class = ClassTimeout
+	}
+	return fetchErr
+}
+
+// retryAfterOf returns the wait a host asked for with the error, or 0
+func retryAfterOf(err error) time.Duration {
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr.RetryAfter
+	}
+	return 0
+}
+
+// hostPausedError is returned by processURL, without fetching, for a host that
+// asked not to be fetched until a time that is further away than a request would wait
+type hostPausedError struct {
+	host  string
+	until time.Time
+}
+
+func (e *hostPausedError) Error() string {
+	return fmt.Sprintf("host %s is paused until %s", e.host, e.until.Format(time.RFC3339))
+}
+
+// errorClassOf returns the class of a processURL error, or "unknown"
+func errorClassOf(err error) string {
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		return string(fetchErr.Class)
+	}
+	return "unknown"
+}
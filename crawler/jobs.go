@@ -0,0 +1,488 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/database"
+	"github.com/MunishMummadi/web-scrapper/queue"
+)
+
+const (
+	// Job statuses
+	JobRunning     = "running"
+	JobPaused      = "paused"
+	JobCompleted   = "completed"
+	JobCancelled   = "cancelled"
+	JobInterrupted = "interrupted" // Its tasks were lost with the in-memory queue on a restart
+
+	// How long a job's status is trusted before it is read from storage again, so
+	// a job paused or cancelled on another node stops here soon after
+	jobStatusRefresh = 2 * time.Second
+)
+
+// createJob persists a crawl started from seeds as a running job
+func (c *Crawler) createJob(ctx context.Context, crawl *crawlState, seeds []*url.URL) error {
+	options, err := json.Marshal(crawl.opts)
+	if err != nil {
+		return fmt.Errorf("failed to encode options of job %s: %w", crawl.id, err)
+	}
+
+	job := database.CrawlJob{
+		ID:        crawl.id,
+		Options:   string(options),
+		Status:    JobRunning,
+		StartedAt: time.Now(),
+	}
+	for _, seed := range seeds {
+		job.Seeds = append(job.Seeds, seed.String())
+	}
+	return c.storage.SaveCrawlJob(ctx, job)
+}
+
+// loadCrawl returns the crawl of a job, restoring it from storage with the job's
+// options, seeds and status when it isn't tracked in memory.
+// Returns sql.ErrNoRows if there is no such job.
+func (c *Crawler) loadCrawl(ctx context.Context, id string) (*crawlState, error) {
+	c.crawlsMu.Lock()
+	crawl, ok := c.crawls[id]
+	c.crawlsMu.Unlock()
+	if ok {
+		return crawl, nil
+	}
+
+	job, err := c.storage.GetCrawlJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts CrawlOptions
+	if err := json.Unmarshal([]byte(job.Options), &opts); err != nil {
+		return nil, fmt.Errorf("failed to decode options of job %s: %w", id, err)
+	}
+	var seeds []*url.URL
+	for _, seed := range job.Seeds {
+		if u, err := url.Parse(seed); err == nil {
+			seeds = append(seeds, u)
+		}
+	}
+	crawl, err = newCrawlState(id, opts, seeds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options of job %s: %w", id, err)
+	}
+	crawl.job = true
+	crawl.status = job.Status
+	crawl.statusAt = time.Now()
+	// Every task the job has counted was admitted, so it used up that much budget
+	crawl.pages = job.Queued + job.InFlight + job.Succeeded + job.Failed + job.Skipped
+	return c.registerCrawl(crawl), nil
+}
+
+// jobProgress applies a change to the task counts of the crawl's job and
+// completes the job once it has nothing left queued or in flight.
+// It uses a fresh context since it also runs while the crawler is shutting down.
+func (c *Crawler) jobProgress(crawl *crawlState, delta database.CrawlJobCounts) {
+	if !crawl.isJob() {
+		return
+	}
+	crawl.touch()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, err := c.storage.UpdateCrawlJobCounts(ctx, crawl.id, c.nodeID, delta)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error updating progress of job %s: %v", crawl.id, err)
+		}
+		return
+	}
+	if job.Status != JobRunning || job.Queued > 0 || job.InFlight > 0 || crawl.isSeeding() {
+		return
+	}
+
+	completed, err := c.updateJobStatus(ctx, crawl, JobCompleted, JobRunning)
+	if err != nil {
+		log.Printf("Error completing job %s: %v", crawl.id, err)
+		return
+	}
+	if completed {
+		log.Printf("Job %s completed: %d succeeded, %d failed, %d skipped", crawl.id, job.Succeeded, job.Failed, job.Skipped)
+	}
+}
+
+// updateJobStatus moves the crawl's job to status if its current status is one of from.
+// It reports whether the job was updated.
+func (c *Crawler) updateJobStatus(ctx context.Context, crawl *crawlState, status string, from ...string) (bool, error) {
+	var finishedAt time.Time
+	if status != JobRunning && status != JobPaused {
+		finishedAt = time.Now()
+	}
+	updated, err := c.storage.UpdateCrawlJobStatus(ctx, crawl.id, status, finishedAt, from...)
+	if err != nil || !updated {
+		return false, err
+	}
+	crawl.setStatus(status)
+	return true, nil
+}
+
+// refreshJobStatus reads the status of the crawl's job from storage once the one
+// tracked here is older than jobStatusRefresh. When the job was paused or
+// cancelled elsewhere meanwhile, its tasks queued or buffered here are parked
+// or dropped as if it had happened on this node.
+// It uses a fresh context like jobProgress.
+func (c *Crawler) refreshJobStatus(crawl *crawlState) {
+	if !crawl.isJob() || !crawl.statusStale() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, err := c.storage.GetCrawlJob(ctx, crawl.id)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error refreshing status of job %s: %v", crawl.id, err)
+		}
+		return
+	}
+	previous := crawl.setStatus(job.Status)
+	if previous == job.Status {
+		return
+	}
+	log.Printf("Job %s is now %s", crawl.id, job.Status)
+
+	switch job.Status {
+	case JobPaused:
+		tasks := c.parkQueued(ctx, crawl)
+		log.Printf("Parked %d queued tasks of paused job %s", len(tasks), crawl.id)
+	case JobCancelled:
+		tasks := c.dropQueued(ctx, crawl)
+		log.Printf("Drained %d queued tasks of cancelled job %s", len(tasks), crawl.id)
+	}
+}
+
+// parkQueued takes the job's tasks off the queue and parks them, returning them
+func (c *Crawler) parkQueued(ctx context.Context, crawl *crawlState) []*queue.Task {
+	// Anything this misses is parked by the worker that dequeues it
+	tasks, err := c.queue.RemoveCrawl(ctx, crawl.id)
+	if err != nil {
+		log.Printf("Error removing queued tasks of paused job %s: %v", crawl.id, err)
+	}
+	if err := c.parkTasks(ctx, crawl, tasks); err != nil {
+		// Put them back rather than lose them, they get parked when dequeued
+		log.Printf("Error parking tasks of job %s: %v", crawl.id, err)
+		for _, task := range tasks {
+			if err := c.queue.Enqueue(ctx, task); err != nil {
+				log.Printf("Error requeueing URL %s of job %s: %v", task.URL, crawl.id, err)
+			}
+		}
+	}
+	return tasks
+}
+
+// dropQueued takes the job's tasks off the queue for good, counting them as
+// skipped and forgetting their URLs, and returns them
+func (c *Crawler) dropQueued(ctx context.Context, crawl *crawlState) []*queue.Task {
+	// Anything this misses is dropped by the worker that dequeues it
+	tasks, err := c.queue.RemoveCrawl(ctx, crawl.id)
+	if err != nil {
+		log.Printf("Error draining queued tasks of cancelled job %s: %v", crawl.id, err)
+	}
+	for _, task := range tasks {
+		c.forget(task.URL)
+	}
+	if len(tasks) > 0 {
+		c.jobProgress(crawl, database.CrawlJobCounts{Queued: -len(tasks), Skipped: len(tasks)})
+	}
+	return tasks
+}
+
+// startTask moves a dequeued task of a job in flight. Tasks of a paused job are
+// parked until it resumes and tasks of a cancelled job are dropped; for those
+// the task is settled here and startTask returns false.
+func (c *Crawler) startTask(id int, crawl *crawlState, task *queue.Task) bool {
+	c.refreshJobStatus(crawl)
+	switch crawl.jobStatus() {
+	case JobPaused:
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := c.parkTasks(ctx, crawl, []*queue.Task{task}); err != nil {
+			log.Printf("Worker %d: Error parking URL %s of paused job %s: %v", id, task.URL, crawl.id, err)
+			c.settle(id, task, false)
+			return false
+		}
+		c.settle(id, task, true)
+		return false
+	case JobCancelled:
+		log.Printf("Worker %d: Dropping URL %s of cancelled job %s", id, task.URL, crawl.id)
+		c.settle(id, task, true)
+		c.forget(task.URL)
+		c.jobProgress(crawl, database.CrawlJobCounts{Queued: -1, Skipped: 1})
+		return false
+	}
+
+	c.jobProgress(crawl, database.CrawlJobCounts{Queued: -1, InFlight: 1})
+	return true
+}
+
+// parkTasks keeps tasks taken off the queue in storage while their job is paused
+func (c *Crawler) parkTasks(ctx context.Context, crawl *crawlState, tasks []*queue.Task) error {
+	payloads := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		payload, err := task.Encode()
+		if err != nil {
+			log.Printf("Error parking URL %s of job %s: %v", task.URL, crawl.id, err)
+			continue
+		}
+		payloads = append(payloads, payload)
+	}
+	return c.storage.ParkCrawlJobTasks(ctx, crawl.id, payloads)
+}
+
+// jobCrawl returns the crawl of a job for the job controls
+func (c *Crawler) jobCrawl(ctx context.Context, id string) (*crawlState, error) {
+	crawl, err := c.loadCrawl(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !crawl.isJob()) {
+		return nil, ErrJobNotFound
+	}
+	return crawl, err
+}
+
+// jobStateError explains why a job can't be paused, resumed or cancelled right now
+func (c *Crawler) jobStateError(ctx context.Context, id, action string) error {
+	job, err := c.storage.GetCrawlJob(ctx, id)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: cannot %s job %s while it is %s", ErrJobState, action, id, job.Status)
+}
+
+// PauseJob stops handing out the tasks of a running job. Its queued tasks are
+// taken off the queue and parked until the job is resumed; tasks already in
+// flight finish, and the links they discover are parked when dequeued.
+func (c *Crawler) PauseJob(ctx context.Context, id string) (database.CrawlJob, error) {
+	crawl, err := c.jobCrawl(ctx, id)
+	if err != nil {
+		return database.CrawlJob{}, err
+	}
+	paused, err := c.updateJobStatus(ctx, crawl, JobPaused, JobRunning)
+	if err != nil {
+		return database.CrawlJob{}, err
+	}
+	if !paused {
+		return database.CrawlJob{}, c.jobStateError(ctx, id, "pause")
+	}
+
+	tasks := c.parkQueued(ctx, crawl)
+	log.Printf("Paused job %s, parked %d queued tasks", id, len(tasks))
+
+	return c.storage.GetCrawlJob(ctx, id)
+}
+
+// ResumeJob puts the parked tasks of a paused job back on the queue
+func (c *Crawler) ResumeJob(ctx context.Context, id string) (database.CrawlJob, error) {
+	crawl, err := c.jobCrawl(ctx, id)
+	if err != nil {
+		return database.CrawlJob{}, err
+	}
+	resumed, err := c.updateJobStatus(ctx, crawl, JobRunning, JobPaused)
+	if err != nil {
+		return database.CrawlJob{}, err
+	}
+	if !resumed {
+		return database.CrawlJob{}, c.jobStateError(ctx, id, "resume")
+	}
+
+	payloads, err := c.storage.TakeCrawlJobTasks(ctx, id)
+	if err != nil {
+		// The tasks are still parked, leave the job paused so it can be resumed again
+		if _, revertErr := c.updateJobStatus(ctx, crawl, JobPaused, JobRunning); revertErr != nil {
+			log.Printf("Error pausing job %s again: %v", id, revertErr)
+		}
+		return database.CrawlJob{}, err
+	}
+
+	var unqueued []*queue.Task
+	for _, payload := range payloads {
+		task, err := queue.DecodeTask(payload)
+		if err != nil {
+			log.Printf("Error restoring parked task of job %s: %v", id, err)
+			continue
+		}
+		if err := c.queue.Enqueue(ctx, task); err != nil {
+			log.Printf("Error requeueing URL %s of job %s: %v", task.URL, id, err)
+			unqueued = append(unqueued, task)
+		}
+	}
+	if len(unqueued) > 0 {
+		// Keep what couldn't be queued, it goes out with the next pause and resume
+		if err := c.parkTasks(ctx, crawl, unqueued); err != nil {
+			log.Printf("Error parking tasks of job %s: %v", id, err)
+		}
+	}
+	log.Printf("Resumed job %s, requeued %d parked tasks", id, len(payloads)-len(unqueued))
+
+	// The job may have had nothing left but what was parked
+	c.jobProgress(crawl, database.CrawlJobCounts{})
+	return c.storage.GetCrawlJob(ctx, id)
+}
+
+// CancelJob stops a running or paused job for good. Its queued and parked tasks
+// are drained and counted as skipped, and their URLs are forgotten by the
+// seen-set so other crawls can pick them up.
+func (c *Crawler) CancelJob(ctx context.Context, id string) (database.CrawlJob, error) {
+	crawl, err := c.jobCrawl(ctx, id)
+	if err != nil {
+		return database.CrawlJob{}, err
+	}
+	cancelled, err := c.updateJobStatus(ctx, crawl, JobCancelled, JobRunning, JobPaused)
+	if err != nil {
+		return database.CrawlJob{}, err
+	}
+	if !cancelled {
+		return database.CrawlJob{}, c.jobStateError(ctx, id, "cancel")
+	}
+
+	tasks := c.dropQueued(ctx, crawl)
+	payloads, err := c.storage.TakeCrawlJobTasks(ctx, id)
+	if err != nil {
+		log.Printf("Error draining parked tasks of cancelled job %s: %v", id, err)
+	}
+	parked := 0
+	for _, payload := range payloads {
+		if task, err := queue.DecodeTask(payload); err == nil {
+			c.forget(task.URL)
+			parked++
+		}
+	}
+	if parked > 0 {
+		c.jobProgress(crawl, database.CrawlJobCounts{Queued: -parked, Skipped: parked})
+	}
+	log.Printf("Cancelled job %s, drained %d queued tasks", id, len(tasks)+parked)
+
+	return c.storage.GetCrawlJob(ctx, id)
+}
+
+// RecoverJobs reconciles the jobs a previous run of this node left unfinished;
+// call it before Start. Only the tasks this node had in flight are recovered,
+// other nodes sharing the storage may still be working on theirs. With a durable
+// queue, those tasks are handed back to the queue, so they count as queued again.
+// Otherwise the queue was lost with the process: running jobs are marked
+// interrupted, and paused jobs keep their parked tasks but lose the ones that
+// were in flight.
+func (c *Crawler) RecoverJobs(ctx context.Context, durable bool) error {
+	inFlight, err := c.storage.GetCrawlJobsInFlight(ctx, c.nodeID)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range []string{JobRunning, JobPaused} {
+		jobs, err := c.storage.GetCrawlJobs(ctx, status, 0, 0)
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			stale := inFlight[job.ID]
+			delta := database.CrawlJobCounts{InFlight: -stale}
+			if durable {
+				delta.Queued = stale
+			} else if status == JobPaused {
+				delta.Skipped = stale
+			}
+			if stale > 0 {
+				if _, err := c.storage.UpdateCrawlJobCounts(ctx, job.ID, c.nodeID, delta); err != nil {
+					return err
+				}
+			}
+
+			if !durable && status == JobRunning {
+				if _, err := c.storage.UpdateCrawlJobStatus(ctx, job.ID, JobInterrupted, time.Now(), JobRunning); err != nil {
+					return err
+				}
+				log.Printf("Recovered job %s (%s)", job.ID, JobInterrupted)
+			} else if stale > 0 {
+				log.Printf("Recovered %d tasks of job %s that were in flight (%s)", stale, job.ID, status)
+			}
+		}
+	}
+	return nil
+}
+
+// CrawlActive reports whether a crawl job is still running or paused.
+// Unknown crawls are not active.
+func (c *Crawler) CrawlActive(crawlID string) bool {
+	if crawlID == "" {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job, err := c.storage.GetCrawlJob(ctx, crawlID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting job %s: %v", crawlID, err)
+		}
+		return false
+	}
+	return job.FinishedAt.IsZero()
+}
+
+// isJob reports whether the crawl is tracked as a job
+func (s *crawlState) isJob() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.job
+}
+
+// jobStatus returns the status of the crawl's job
+func (s *crawlState) jobStatus() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// setStatus records the job's current status and returns the previous one
+func (s *crawlState) setStatus(status string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.status
+	s.status = status
+	s.statusAt = time.Now()
+	return previous
+}
+
+// statusStale reports whether the job's status is due to be read from storage again
+func (s *crawlState) statusStale() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Since(s.statusAt) >= jobStatusRefresh
+}
+
+// isSeeding reports whether the crawl's seeds are still being enqueued
+func (s *crawlState) isSeeding() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seeding
+}
+
+// seeded records that every seed of the crawl has been enqueued
+func (s *crawlState) seeded() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seeding = false
+}
+
+// touch records activity so the crawl isn't forgotten while it makes progress
+func (s *crawlState) touch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastActivity = time.Now()
+}
@@ -0,0 +1,153 @@
+package crawler
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// linkAttrs maps the elements we follow to the attribute holding their target
+var linkAttrs = map[string]string{
+	"a":      "href",
+	"link":   "href",
+	"area":   "href",
+	"iframe": "src",
+}
+
+// isHTMLContent reports whether a Content-Type header describes an HTML document
+func isHTMLContent(contentType string) bool {
+	if contentType == "" {
+		return true // Servers often omit it for HTML, let the parser decide
+	}
+	contentType = strings.ToLower(contentType)
+	return strings.Contains(contentType, "text/html") || strings.Contains(contentType, "application/xhtml")
+}
+
+// parsedPage is what an HTML page tells the crawler about where to go next
+type parsedPage struct {
+	links         []string         // Links to follow
+	nofollowLinks []string         // Links only marked rel="nofollow", not in links
+	robots        robotsDirectives // From <meta name="robots"> and the meta tag named after our agent
+}
+
+// parsePage parses an HTML document for the absolute URLs it links to and its robots
+// meta tags. Relative targets are resolved against <base href> when present, otherwise
+// against the URL the page was fetched from. Duplicates are removed while preserving
+// document order. agent is our agentToken, matched against the meta tag names.
+func parsePage(pageURL *url.URL, body []byte, agent string) parsedPage {
+	var page parsedPage
+	base := pageURL
+	seen := make(map[string]struct{})
+	nofollow := make(map[string]struct{})
+	var nofollowOrder []string
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			// io.EOF or a malformed document, either way we are done
+			break
+		}
+		if tokenType != html.StartTagToken && tokenType != html.SelfClosingTagToken {
+			continue
+		}
+
+		token := tokenizer.Token()
+		tag := token.Data
+
+		// <base href> changes the resolution root for every link after it
+		if tag == "base" {
+			if href := attrValue(token, "href"); href != "" {
+				if baseURL, err := pageURL.Parse(href); err == nil {
+					base = baseURL
+				}
+			}
+			continue
+		}
+
+		if tag == "meta" {
+			name := strings.ToLower(attrValue(token, "name"))
+			if name == "robots" || (agent != "" && name == agent) {
+				page.robots.add(attrValue(token, "content"))
+			}
+			continue
+		}
+
+		attr, ok := linkAttrs[tag]
+		if !ok {
+			continue
+		}
+
+		link := resolveLink(base, attrValue(token, attr))
+		if link == "" {
+			continue
+		}
+		if hasRel(token, "nofollow") {
+			if _, dup := nofollow[link]; !dup {
+				nofollow[link] = struct{}{}
+				nofollowOrder = append(nofollowOrder, link)
+			}
+			continue
+		}
+		if _, dup := seen[link]; dup {
+			continue
+		}
+		seen[link] = struct{}{}
+		page.links = append(page.links, link)
+	}
+
+	// A link that is also followable elsewhere on the page is followed
+	for _, link := range nofollowOrder {
+		if _, followed := seen[link]; !followed {
+			page.nofollowLinks = append(page.nofollowLinks, link)
+		}
+	}
+	return page
+}
+
+// hasRel reports whether a link's rel attribute holds the given keyword
+func hasRel(token html.Token, keyword string) bool {
+	for _, rel := range strings.Fields(attrValue(token, "rel")) {
+		if strings.EqualFold(rel, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// attrValue returns the value of the named attribute, or "" if it is missing
+func attrValue(token html.Token, name string) string {
+	for _, attr := range token.Attr {
+		if attr.Key == name {
+			return strings.TrimSpace(attr.Val)
+		}
+	}
+	return ""
+}
+
+// resolveLink resolves href against base and returns an absolute http(s) URL
+// without its fragment, or "" if the link cannot or should not be followed
+func resolveLink(base *url.URL, href string) string {
+	if href == "" || strings.HasPrefix(href, "#") {
+		return ""
+	}
+
+	resolved, err := base.Parse(href)
+	if err != nil {
+		return ""
+	}
+
+	// Skip mailto:, javascript:, data: and friends
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return ""
+	}
+	if resolved.Host == "" {
+		return ""
+	}
+
+	resolved.Fragment = ""
+	resolved.RawFragment = ""
+	return resolved.String()
+}
@@ -0,0 +1,124 @@
+package crawler
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Sources of a robots directive, the source label of the suppression counter
+const (
+	robotsSourceMeta   = "meta"   // <meta name="robots"> or <meta name="{agent}">
+	robotsSourceHeader = "header" // X-Robots-Tag response header
+	robotsSourceLink   = "link"   // rel="nofollow" on a link
+)
+
+// robotsDirectives are the indexing rules a page gives crawlers
+type robotsDirectives struct {
+	noindex  bool // Don't store the page's content
+	nofollow bool // Don't follow the page's links
+}
+
+// add applies a comma-separated list of directives such as "noindex, nofollow".
+// Directives other crawlers use for snippets, archiving or expiry are ignored.
+func (d *robotsDirectives) add(list string) {
+	for _, directive := range strings.Split(list, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "noindex":
+			d.noindex = true
+		case "nofollow":
+			d.nofollow = true
+		case "none":
+			d.noindex = true
+			d.nofollow = true
+		}
+	}
+}
+
+// parseRobotsHeader reads the X-Robots-Tag headers of a response. A value may be
+// scoped to a crawler with an "agent:" prefix; only unscoped values and the ones
+// naming agent apply.
+func parseRobotsHeader(header http.Header, agent string) robotsDirectives {
+	var directives robotsDirectives
+	for _, value := range header.Values("X-Robots-Tag") {
+		if name, rest, found := strings.Cut(value, ":"); found && isRobotsAgent(name) {
+			if !strings.EqualFold(strings.TrimSpace(name), agent) {
+				continue
+			}
+			value = rest
+		}
+		directives.add(value)
+	}
+	return directives
+}
+
+// isRobotsAgent tells a crawler name before a colon in X-Robots-Tag from a
+// directive that takes a value, such as "unavailable_after: 2025-01-01"
+func isRobotsAgent(name string) bool {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsAny(name, ", ") {
+		return false
+	}
+	switch strings.ToLower(name) {
+	case "unavailable_after", "max-snippet", "max-image-preview", "max-video-preview":
+		return false
+	}
+	return true
+}
+
+// agentToken returns the name a user agent goes by in robots meta tags and
+// X-Robots-Tag, its product token in lower case ("scraper" for "Scraper/1.0")
+func agentToken(userAgent string) string {
+	token := strings.TrimSpace(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+	return strings.ToLower(token)
+}
+
+// pageRobots combines the directives of a page's X-Robots-Tag header and meta tags.
+// Each directive that applies is logged and counted by its source.
+func (c *Crawler) pageRobots(urlStr string, resp *http.Response, parsed parsedPage, agent string) robotsDirectives {
+	header := parseRobotsHeader(resp.Header, agent)
+	directives := robotsDirectives{
+		noindex:  header.noindex || parsed.robots.noindex,
+		nofollow: header.nofollow || parsed.robots.nofollow,
+	}
+
+	source := func(fromHeader bool) string {
+		if fromHeader {
+			return robotsSourceHeader
+		}
+		return robotsSourceMeta
+	}
+	if directives.noindex {
+		log.Printf("URL %s is marked noindex, not storing its content", urlStr)
+		c.metrics.IncrementRobotsSuppressed("noindex", source(header.noindex))
+	}
+	if directives.nofollow {
+		log.Printf("URL %s is marked nofollow, not following its links", urlStr)
+		c.metrics.IncrementRobotsSuppressed("nofollow", source(header.nofollow))
+	}
+	return directives
+}
+
+// dropPage removes what was stored of a page that is now marked noindex: its scrape
+// data, its version history and the bodies no other page shares
+func (c *Crawler) dropPage(ctx context.Context, urlStr string) {
+	orphaned, err := c.storage.DeletePage(ctx, urlStr)
+	if err != nil {
+		log.Printf("Error deleting stored copy of noindex page %s: %v", urlStr, err)
+		return
+	}
+	log.Printf("Deleted stored copy of %s, it is now marked noindex", urlStr)
+
+	if c.blobs == nil {
+		return
+	}
+	for _, hash := range orphaned {
+		if err := c.blobs.Delete(ctx, hash); err != nil {
+			log.Printf("Error deleting body %s of %s: %v", hash, urlStr, err)
+		}
+	}
+}
@@ -17,6 +17,9 @@ type HostRateLimiter struct {
 	cleanup    *time.Ticker
 	ttl        time.Duration
 	lastUsed   map[string]time.Time
+	custom     map[string]bool          // Hosts whose rate was set with SetRate
+	paused     map[string]time.Time     // Hosts that asked not to be fetched before a time
+	delays     map[string]time.Duration // Crawl-delay asked for by a host's robots.txt
 }
 
 // NewHostRateLimiter creates a new rate limiter for hosts
@@ -29,6 +32,9 @@ func NewHostRateLimiter(defaultQPS float64, defaultRPS int) *HostRateLimiter {
 		defaultRPS: defaultRPS,
 		ttl:        time.Hour, // Cleanup unused limiters after 1 hour
 		lastUsed:   make(map[string]time.Time),
+		custom:     make(map[string]bool),
+		paused:     make(map[string]time.Time),
+		delays:     make(map[string]time.Duration),
 	}
 
 	// Start a cleanup routine
@@ -40,6 +46,16 @@ func NewHostRateLimiter(defaultQPS float64, defaultRPS int) *HostRateLimiter {
 
 // Wait blocks until the rate limit allows an event for the host or ctx is done
 func (h *HostRateLimiter) Wait(ctx context.Context, host string) error {
+	if pause := time.Until(h.PausedUntil(host)); pause > 0 {
+		timer := time.NewTimer(pause)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
 	limiter := h.getLimiter(host)
 	h.updateLastUsed(host)
 	return limiter.Wait(ctx) // This blocks until rate limit allows or ctx cancelled
@@ -48,6 +64,9 @@ func (h *HostRateLimiter) Wait(ctx context.Context, host string) error {
 // Allow reports whether an event may happen for the host
 // Does not block, but rather reports if rate limit would allow
 func (h *HostRateLimiter) Allow(host string) bool {
+	if h.PausedUntil(host).After(time.Now()) {
+		return false
+	}
 	limiter := h.getLimiter(host)
 	allowed := limiter.Allow()
 	if allowed {
@@ -56,15 +75,147 @@ func (h *HostRateLimiter) Allow(host string) bool {
 	return allowed
 }
 
+// NextAllowed returns the earliest time a request to the host would not have to wait
+func (h *HostRateLimiter) NextAllowed(host string) time.Time {
+	limiter := h.getLimiter(host)
+	now := time.Now()
+	if paused := h.PausedUntil(host); paused.After(now) {
+		return paused
+	}
+	tokens := limiter.TokensAt(now)
+	if tokens >= 1 || limiter.Limit() == rate.Inf {
+		return now
+	}
+	if limiter.Limit() <= 0 {
+		return now.Add(h.ttl) // Host is blocked, check back much later
+	}
+	wait := (1 - tokens) / float64(limiter.Limit())
+	return now.Add(time.Duration(wait * float64(time.Second)))
+}
+
+// Interval returns the minimum spacing between requests to the host at its sustained rate
+func (h *HostRateLimiter) Interval(host string) time.Duration {
+	limit := h.getLimiter(host).Limit()
+	if limit == rate.Inf || limit <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / float64(limit))
+}
+
 // SetRate changes the rate limit for a specific host
 func (h *HostRateLimiter) SetRate(host string, qps float64, rps int) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	h.limiters[host] = rate.NewLimiter(rate.Limit(qps), rps)
+	if limiter, exists := h.limiters[host]; exists {
+		// Keep the tokens already spent so the new rate applies from the last request on
+		limiter.SetLimit(rate.Limit(qps))
+		limiter.SetBurst(rps)
+	} else {
+		h.limiters[host] = rate.NewLimiter(rate.Limit(qps), rps)
+	}
+	h.lastUsed[host] = time.Now()
+	h.custom[host] = true
+}
+
+// ResetRate puts a host whose rate was set with SetRate back on the default rate
+func (h *HostRateLimiter) ResetRate(host string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if limiter, exists := h.limiters[host]; exists {
+		qps, burst := h.baseRate(host)
+		limiter.SetLimit(rate.Limit(qps))
+		limiter.SetBurst(burst)
+	}
+	delete(h.custom, host)
+}
+
+// SetCrawlDelay sets the spacing a host asked for in its robots.txt, 0 removes it.
+// The host is never fetched faster than the default rate, and a rate set with
+// SetRate stays in place until ResetRate.
+func (h *HostRateLimiter) SetCrawlDelay(host string, delay time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if delay <= 0 {
+		if _, exists := h.delays[host]; !exists {
+			return
+		}
+		delete(h.delays, host)
+	} else {
+		if h.delays[host] == delay {
+			return
+		}
+		h.delays[host] = delay
+	}
+	if limiter, exists := h.limiters[host]; exists && !h.custom[host] {
+		qps, burst := h.baseRate(host)
+		limiter.SetLimit(rate.Limit(qps))
+		limiter.SetBurst(burst)
+	}
+}
+
+// BaseInterval returns the spacing between requests to the host when nothing slowed
+// it down: the default delay, or its robots.txt crawl-delay when that is longer
+func (h *HostRateLimiter) BaseInterval(host string) time.Duration {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	qps, _ := h.baseRate(host)
+	if qps <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / qps)
+}
+
+// baseRate returns the rate and burst of a host without a rate set by SetRate.
+// The caller must hold mu.
+func (h *HostRateLimiter) baseRate(host string) (float64, int) {
+	delay, exists := h.delays[host]
+	if !exists {
+		return h.defaultQPS, h.defaultRPS
+	}
+	qps := 1 / delay.Seconds()
+	if qps > h.defaultQPS {
+		qps = h.defaultQPS
+	}
+	return qps, 1 // A crawl-delay spaces out every request
+}
+
+// Pause holds back requests to the host until the given time, e.g. as asked by a
+// Retry-After header. An earlier pause is only ever extended.
+func (h *HostRateLimiter) Pause(host string, until time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if until.After(h.paused[host]) {
+		h.paused[host] = until
+	}
 	h.lastUsed[host] = time.Now()
 }
 
+// PausedUntil returns the time a paused host may be fetched again, or the zero time
+func (h *HostRateLimiter) PausedUntil(host string) time.Time {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.paused[host]
+}
+
+// SetDefaultRate changes the rate of every host without a rate set by SetRate
+func (h *HostRateLimiter) SetDefaultRate(qps float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.defaultQPS = qps
+	for host, limiter := range h.limiters {
+		if !h.custom[host] {
+			hostQPS, _ := h.baseRate(host)
+			limiter.SetLimit(rate.Limit(hostQPS))
+		}
+	}
+}
+
 // getLimiter gets or creates a rate limiter for a host
 func (h *HostRateLimiter) getLimiter(host string) *rate.Limiter {
 	h.mu.RLock()
@@ -76,7 +227,8 @@ func (h *HostRateLimiter) getLimiter(host string) *rate.Limiter {
 		// Double-check (another goroutine might have created it)
 		limiter, exists = h.limiters[host]
 		if !exists {
-			limiter = rate.NewLimiter(rate.Limit(h.defaultQPS), h.defaultRPS)
+			qps, burst := h.baseRate(host)
+			limiter = rate.NewLimiter(rate.Limit(qps), burst)
 			h.limiters[host] = limiter
 			h.lastUsed[host] = time.Now()
 		}
@@ -103,6 +255,9 @@ func (h *HostRateLimiter) cleanupRoutine() {
 			if now.Sub(lastUsed) > h.ttl {
 				delete(h.limiters, host)
 				delete(h.lastUsed, host)
+				delete(h.custom, host)
+				delete(h.paused, host)
+				delete(h.delays, host)
 			}
 		}
 		
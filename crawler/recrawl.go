@@ -0,0 +1,174 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/config"
+	"github.com/MunishMummadi/web-scrapper/database"
+	"github.com/MunishMummadi/web-scrapper/queue"
+)
+
+const (
+	recrawlBackoff = 1.5 // Interval growth after a visit found the page unchanged
+	recrawlTighten = 0.5 // Interval shrink after a visit found the page changed
+
+	recrawlCrawlID = "recrawl" // Crawl every recrawl batch is tracked under
+)
+
+// recrawlScheduler adapts how often each page is revisited to how often its
+// content actually changes, and enqueues pages once their next visit is due
+type recrawlScheduler struct {
+	crawler *Crawler
+	cfg     config.RecrawlConfig
+	initial time.Duration // Interval of a page that was just crawled for the first time
+	crawl   *crawlState   // Per-host budget of the current batch
+}
+
+// newRecrawlScheduler creates a scheduler for the crawler's pages. Pages start
+// out with the cache expiration as their interval, within the configured bounds.
+func newRecrawlScheduler(c *Crawler, cfg config.RecrawlConfig, initial time.Duration) *recrawlScheduler {
+	if cfg.MinInterval <= 0 {
+		cfg.MinInterval = time.Minute
+	}
+	if cfg.MaxInterval < cfg.MinInterval {
+		cfg.MaxInterval = cfg.MinInterval
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = time.Minute
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.MaxPerHost < 0 {
+		cfg.MaxPerHost = 0
+	}
+
+	s := &recrawlScheduler{crawler: c, cfg: cfg}
+	s.initial = s.clamp(initial)
+	// Valid options by construction, the scope has no patterns to compile
+	s.crawl, _ = newCrawlState(recrawlCrawlID, CrawlOptions{
+		MaxPagesPerHost: cfg.MaxPerHost,
+		Scope:           config.ScopeConfig{Mode: ScopeAny},
+		Priority:        queue.PriorityRecrawl,
+		LinkPriority:    queue.PriorityRecrawl,
+	}, nil)
+	return s
+}
+
+// observe reschedules a page after a successful fetch: pages that changed since
+// the previous visit are revisited sooner, unchanged ones later
+func (s *recrawlScheduler) observe(ctx context.Context, urlStr string, changed bool) {
+	schedule, err := s.crawler.storage.GetRecrawlSchedule(ctx, urlStr)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		schedule = database.RecrawlSchedule{URL: urlStr, Interval: s.initial}
+	case err != nil:
+		log.Printf("Error getting recrawl schedule for %s: %v", urlStr, err)
+		return
+	case changed:
+		schedule.Changes++
+		schedule.Interval = time.Duration(float64(schedule.Interval) * recrawlTighten)
+	default:
+		schedule.Interval = time.Duration(float64(schedule.Interval) * recrawlBackoff)
+	}
+
+	schedule.Visits++
+	schedule.Interval = s.clamp(schedule.Interval)
+	schedule.NextVisitAt = time.Now().Add(schedule.Interval)
+	if err := s.crawler.storage.SaveRecrawlSchedule(ctx, schedule); err != nil {
+		log.Printf("Error saving recrawl schedule for %s: %v", urlStr, err)
+	}
+}
+
+// clamp bounds an interval by the configured minimum and maximum
+func (s *recrawlScheduler) clamp(interval time.Duration) time.Duration {
+	if interval < s.cfg.MinInterval {
+		return s.cfg.MinInterval
+	}
+	if interval > s.cfg.MaxInterval {
+		return s.cfg.MaxInterval
+	}
+	return interval
+}
+
+// run periodically enqueues the pages that are due until the crawler stops
+func (s *recrawlScheduler) run(ctx context.Context) {
+	defer s.crawler.wg.Done()
+
+	ticker := time.NewTicker(s.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.crawler.stopChan:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.enqueueDue(ctx)
+		}
+	}
+}
+
+// enqueueDue enqueues a batch of due pages. Batches are tracked under one crawl
+// whose per-host budget starts over with each batch, so it caps how many pages
+// of one host a batch enqueues.
+func (s *recrawlScheduler) enqueueDue(ctx context.Context) {
+	c := s.crawler
+	now := time.Now()
+
+	due, err := c.storage.GetDueRecrawls(ctx, now, s.cfg.BatchSize)
+	if err != nil {
+		log.Printf("Error getting pages due for a recrawl: %v", err)
+		return
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	crawl := s.crawl
+	crawl.resetBudget()
+	c.trackCrawl(crawl)
+
+	enqueued := 0
+	for _, schedule := range due {
+		u, err := url.Parse(schedule.URL)
+		if err != nil {
+			log.Printf("Invalid URL %s in recrawl schedule: %v", schedule.URL, err)
+			continue
+		}
+
+		// Move the next visit out right away so the page isn't enqueued again
+		// while it waits in the queue; the fetch reschedules it properly
+		next := now.Add(schedule.Interval)
+		if decision, reason := crawl.admit(u, 0, true); decision != DecisionEnqueued {
+			c.recordDecision(ctx, crawl.id, schedule.URL, "", 0, decision, reason)
+			// Over the host's budget, let other hosts' due pages go first next time
+			next = now.Add(s.cfg.CheckInterval)
+		} else {
+			task := queue.NewTask(schedule.URL)
+			task.CrawlID = crawl.id
+			task.Priority = queue.PriorityRecrawl
+			task.Recrawl = true
+			if err := c.EnqueueTask(ctx, task); err != nil {
+				crawl.release(u)
+				c.recordDecision(ctx, crawl.id, schedule.URL, "", 0, DecisionDropped, ReasonEnqueueFailed)
+				log.Printf("Error enqueueing recrawl of %s: %v", schedule.URL, err)
+				return // The page stays due, try again on the next check
+			}
+			c.recordDecision(ctx, crawl.id, schedule.URL, "", 0, DecisionEnqueued, ReasonRecrawl)
+			c.metrics.IncrementRecrawls()
+			enqueued++
+		}
+
+		if err := c.storage.PostponeRecrawl(ctx, schedule.URL, next); err != nil {
+			log.Printf("Error postponing recrawl of %s: %v", schedule.URL, err)
+		}
+	}
+	log.Printf("Enqueued %d of %d pages due for a recrawl", enqueued, len(due))
+}
@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MunishMummadi/web-scrapper/config"
+)
+
+// retryPolicy decides how many times a failed fetch is retried from its error class
+// and status code. A negative number of retries stands for the configured maximum.
+type retryPolicy struct {
+	classes      map[ErrorClass]int // Retries per class, the others get the configured maximum
+	statusCodes  map[int]int        // Retries per status code
+	statusRanges map[int]int        // Retries per status class (5 for "5xx"), used when the code isn't listed
+}
+
+// newRetryPolicy parses the retry policy configuration
+func newRetryPolicy(cfg config.RetryPolicyConfig) (*retryPolicy, error) {
+	p := &retryPolicy{
+		classes:      make(map[ErrorClass]int),
+		statusCodes:  make(map[int]int),
+		statusRanges: make(map[int]int),
+	}
+
+	for name, retries := range cfg.Classes {
+		class := ErrorClass(strings.ToLower(name))
+		known := false
+		for _, c := range errorClasses {
+			known = known || c == class
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown error class %q", name)
+		}
+		if class == ClassHTTPStatus {
+			return nil, fmt.Errorf("retries of the %s class are set per status code", class)
+		}
+		p.classes[class] = retries
+	}
+
+	for status, retries := range cfg.StatusCodes {
+		status = strings.ToLower(strings.TrimSpace(status))
+		if len(status) == 3 && strings.HasSuffix(status, "xx") && status[0] >= '1' && status[0] <= '5' {
+			p.statusRanges[int(status[0]-'0')] = retries
+			continue
+		}
+		code, err := strconv.Atoi(status)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status code %q", status)
+		}
+		p.statusCodes[code] = retries
+	}
+	return p, nil
+}
+
+// retries returns how many times a fetch that failed with err may be retried.
+// Errors without a class fall back to maxRetries, the runtime setting.
+func (p *retryPolicy) retries(err error, maxRetries int) int {
+	var fetchErr *FetchError
+	if !errors.As(err, &fetchErr) {
+		return maxRetries
+	}
+	if fetchErr.Permanent {
+		return 0
+	}
+
+	if fetchErr.Class == ClassHTTPStatus {
+		if retries, ok := p.statusCodes[fetchErr.StatusCode]; ok {
+			return orDefault(retries, maxRetries)
+		}
+		if retries, ok := p.statusRanges[fetchErr.StatusCode/100]; ok {
+			return orDefault(retries, maxRetries)
+		}
+		return 0 // Statuses the policy doesn't list won't change on a retry
+	}
+
+	if retries, ok := p.classes[fetchErr.Class]; ok {
+		return orDefault(retries, maxRetries)
+	}
+	return maxRetries
+}
+
+// orDefault returns retries, or maxRetries when retries is negative
+func orDefault(retries, maxRetries int) int {
+	if retries < 0 {
+		return maxRetries
+	}
+	return retries
+}
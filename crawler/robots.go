@@ -1,63 +1,95 @@
 package crawler
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"sync"
 	"time"
 
+	"github.com/MunishMummadi/web-scrapper/config"
 	"github.com/temoto/robotstxt"
+	"golang.org/x/sync/singleflight"
 )
 
-// RobotsCache caches robots.txt files and provides access control methods
+const (
+	maxRobotsSize      = 500 << 10 // Bytes of robots.txt parsed, the limit RFC 9309 asks crawlers to handle at least
+	maxRobotsRedirects = 5         // Redirects followed to reach robots.txt, as RFC 9309 recommends
+)
+
+// errRobotsRedirects stops a robots.txt fetch that redirects too many times
+var errRobotsRedirects = errors.New("too many robots.txt redirects")
+
+// robotsUnavailableError is returned by IsAllowed while the robots.txt of a host
+// can't be fetched (a network error or a 5xx). RFC 9309 asks to treat the host as
+// fully disallowed until then, but it is a temporary state, not a Disallow rule.
+type robotsUnavailableError struct {
+	origin string
+	until  time.Time // When robots.txt is fetched again
+}
+
+func (e *robotsUnavailableError) Error() string {
+	return fmt.Sprintf("robots.txt of %s is unavailable until %s", e.origin, e.until.Format(time.RFC3339))
+}
+
+// RobotsCache caches robots.txt files and provides access control methods. Parsed
+// files are kept in memory in front of a RobotsStore, which can be shared by every
+// node so each robots.txt is only downloaded once per TTL across the cluster.
 type RobotsCache struct {
-	cache     map[string]*robotsEntry
+	cache     map[string]*robotsEntry // Parsed files by origin
+	store     RobotsStore
+	fetches   singleflight.Group // One lookup per origin at a time, the other workers wait for it
 	userAgent string
 	client    *http.Client
 	mu        sync.RWMutex
-	ttl       time.Duration
+	cfg       config.RobotsConfig
 }
 
 type robotsEntry struct {
 	data       *robotstxt.RobotsData
 	fetchedAt  time.Time
+	expiresAt  time.Time
 	statusCode int
+	announced  bool // Sitemaps were handed out by NewSitemaps
 }
 
 // NewRobotsCache creates a new robots.txt cache with the given user agent
-func NewRobotsCache(userAgent string, client *http.Client) *RobotsCache {
+func NewRobotsCache(userAgent string, client *http.Client, store RobotsStore, cfg config.RobotsConfig) *RobotsCache {
+	// Same transport and timeout as the crawler, with the redirect limit of RFC 9309
+	robotsClient := *client
+	robotsClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxRobotsRedirects {
+			return errRobotsRedirects
+		}
+		return nil
+	}
+
 	return &RobotsCache{
 		cache:     make(map[string]*robotsEntry),
+		store:     store,
 		userAgent: userAgent,
-		client:    client,
-		ttl:       24 * time.Hour, // Cache robots.txt for 24 hours
+		client:    &robotsClient,
+		cfg:       cfg,
 	}
 }
 
-// IsAllowed checks if the given URL is allowed to be scraped
+// IsAllowed checks if the given URL is allowed to be scraped. While the host's
+// robots.txt is unreachable it returns false and a *robotsUnavailableError.
 func (rc *RobotsCache) IsAllowed(urlStr string) (bool, error) {
-	parsedURL, err := url.Parse(urlStr)
-	if err != nil {
-		return false, err
-	}
-
-	host := parsedURL.Hostname()
-	robotsURL := (&url.URL{
-		Scheme: parsedURL.Scheme,
-		Host:   parsedURL.Host,
-		Path:   "/robots.txt",
-	}).String()
-
-	// Get or fetch robots data
-	robotsData, err := rc.getRobotsData(robotsURL, host)
+	parsedURL, robotsData, err := rc.entryFor(urlStr)
 	if err != nil {
 		// If we can't fetch robots.txt, err on the side of caution (disallow)
 		return false, err
 	}
 
-	// If status code was 4xx/5xx, assume allowed if 4xx, disallow if 5xx
-	if robotsData.statusCode >= 500 && robotsData.statusCode < 600 {
-		return false, nil
+	// Allowed if robots.txt is missing (4xx), disallowed if it is unreachable (5xx or a failed fetch)
+	if robotsData.statusCode == 0 || (robotsData.statusCode >= 500 && robotsData.statusCode < 600) {
+		origin := (&url.URL{Scheme: parsedURL.Scheme, Host: parsedURL.Host}).String()
+		return false, &robotsUnavailableError{origin: origin, until: robotsData.expiresAt}
 	} else if robotsData.statusCode >= 400 && robotsData.statusCode < 500 {
 		return true, nil
 	}
@@ -70,70 +102,202 @@ func (rc *RobotsCache) IsAllowed(urlStr string) (bool, error) {
 		path += "?" + parsedURL.RawQuery
 	}
 
-	return robotsData.data.TestAgent(path, rc.userAgent), nil
+	return robotsData.data.TestAgent(path, rc.agent()), nil
+}
+
+// CrawlDelay returns the Crawl-delay the URL's host asks of our user agent, if any
+func (rc *RobotsCache) CrawlDelay(urlStr string) (time.Duration, bool) {
+	_, robotsData, err := rc.entryFor(urlStr)
+	if err != nil || robotsData.data == nil {
+		return 0, false
+	}
+	group := robotsData.data.FindGroup(rc.agent())
+	if group == nil || group.CrawlDelay <= 0 {
+		return 0, false
+	}
+	return group.CrawlDelay, true
+}
+
+// Sitemaps returns the sitemap URLs listed in the robots.txt of the URL's host
+func (rc *RobotsCache) Sitemaps(urlStr string) []string {
+	_, robotsData, err := rc.entryFor(urlStr)
+	if err != nil || robotsData.data == nil {
+		return nil
+	}
+	return robotsData.data.Sitemaps
+}
+
+// NewSitemaps returns the sitemap URLs of the URL's host the first time it is asked
+// after the host's robots.txt was fetched, and nil afterwards. This lets the sitemaps
+// be enqueued once when a host is first seen, and again when robots.txt is refreshed.
+func (rc *RobotsCache) NewSitemaps(urlStr string) []string {
+	_, robotsData, err := rc.entryFor(urlStr)
+	if err != nil || robotsData.data == nil {
+		return nil
+	}
+
+	rc.mu.Lock()
+	announced := robotsData.announced
+	robotsData.announced = true
+	rc.mu.Unlock()
+
+	if announced {
+		return nil
+	}
+	return robotsData.data.Sitemaps
+}
+
+// entryFor returns the parsed URL and the robots.txt entry of its host
+func (rc *RobotsCache) entryFor(urlStr string) (*url.URL, *robotsEntry, error) {
+	parsedURL, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// robots.txt applies to one scheme, host and port
+	origin := (&url.URL{Scheme: parsedURL.Scheme, Host: parsedURL.Host}).String()
+
+	// Get or fetch robots data
+	robotsData, err := rc.getRobotsData(origin)
+	if err != nil {
+		return parsedURL, nil, err
+	}
+	return parsedURL, robotsData, nil
+}
+
+// SetUserAgent changes the user agent robots.txt rules are matched and fetched with
+func (rc *RobotsCache) SetUserAgent(userAgent string) {
+	rc.mu.Lock()
+	rc.userAgent = userAgent
+	rc.mu.Unlock()
 }
 
-// getRobotsData gets robots data from cache or fetches it
-func (rc *RobotsCache) getRobotsData(robotsURL, host string) (*robotsEntry, error) {
-	// Check cache first
+// agent returns the current user agent
+func (rc *RobotsCache) agent() string {
 	rc.mu.RLock()
-	entry, exists := rc.cache[host]
+	defer rc.mu.RUnlock()
+	return rc.userAgent
+}
+
+// getRobotsData returns the robots.txt entry of an origin from memory, the store or
+// the origin itself. Concurrent lookups of the same origin share a single fetch.
+func (rc *RobotsCache) getRobotsData(origin string) (*robotsEntry, error) {
+	rc.mu.RLock()
+	entry, exists := rc.cache[origin]
 	rc.mu.RUnlock()
 
-	if exists && time.Since(entry.fetchedAt) < rc.ttl {
+	if exists && time.Now().Before(entry.expiresAt) {
 		return entry, nil
 	}
 
-	// Fetch robots.txt
-	req, err := http.NewRequest("GET", robotsURL, nil)
-	if err != nil {
+	value, err, _ := rc.fetches.Do(origin, func() (interface{}, error) {
+		return rc.load(origin)
+	})
+	if value == nil {
 		return nil, err
 	}
-	req.Header.Set("User-Agent", rc.userAgent)
+	return value.(*robotsEntry), err
+}
 
-	resp, err := rc.client.Do(req)
-	statusCode := 0
+// load takes an origin's robots.txt from the store, or fetches and stores it, and
+// caches the parsed file in memory. A failed fetch is cached too, as a file that
+// disallows everything until it expires.
+func (rc *RobotsCache) load(origin string) (*robotsEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	file, err := rc.store.Get(ctx, origin)
 	if err != nil {
-		// Create an empty robots.txt if we can't fetch it
-		robotsData, _ := robotstxt.FromStatusAndString(statusCode, "")
-		entry := &robotsEntry{
-			data:       robotsData,
-			fetchedAt:  time.Now(),
-			statusCode: statusCode,
+		log.Printf("Error getting cached robots.txt of %s: %v", origin, err)
+	}
+
+	var fetchErr error
+	if file == nil {
+		var fetched RobotsFile
+		fetched, fetchErr = rc.fetch(origin)
+		file = &fetched
+		if err := rc.store.Put(ctx, origin, fetched); err != nil {
+			log.Printf("Error caching robots.txt of %s: %v", origin, err)
 		}
+	}
+
+	if fetchErr != nil {
+		log.Printf("Error fetching robots.txt of %s, disallowing it until %v: %v", origin, file.ExpiresAt.Format(time.RFC3339), fetchErr)
+	}
+
+	entry := newRobotsEntry(file)
+	rc.mu.Lock()
+	rc.cache[origin] = entry
+	rc.mu.Unlock()
+	return entry, nil
+}
 
-		rc.mu.Lock()
-		rc.cache[host] = entry
-		rc.mu.Unlock()
+// fetch downloads the robots.txt of an origin. Redirects are followed up to
+// maxRobotsRedirects hops and only the first maxRobotsSize bytes are read. The
+// file expires after the TTL configured for the outcome.
+func (rc *RobotsCache) fetch(origin string) (RobotsFile, error) {
+	now := time.Now()
+	file := RobotsFile{FetchedAt: now}
 
-		return entry, err
+	req, err := http.NewRequest("GET", origin+"/robots.txt", nil)
+	if err != nil {
+		file.ExpiresAt = now.Add(rc.cfg.NetworkErrorTTL)
+		return file, err
+	}
+	req.Header.Set("User-Agent", rc.agent())
+
+	resp, err := rc.client.Do(req)
+	if errors.Is(err, errRobotsRedirects) {
+		// Treated as unavailable, like a 4xx
+		log.Printf("robots.txt of %s redirects more than %d times, assuming there is none", origin, maxRobotsRedirects)
+		file.StatusCode = http.StatusNotFound
+		file.ExpiresAt = now.Add(rc.cfg.ClientErrorTTL)
+		return file, nil
+	}
+	if err != nil {
+		// Unreachable robots.txt, disallowed until the network error TTL is up
+		file.ExpiresAt = now.Add(rc.cfg.NetworkErrorTTL)
+		return file, fmt.Errorf("failed to fetch robots.txt: %w", err)
 	}
 	defer resp.Body.Close()
 
-	statusCode = resp.StatusCode
-	var robotsData *robotstxt.RobotsData
-	
-	// Parse response depending on status code
-	if statusCode >= 200 && statusCode < 300 {
-		robotsData, err = robotstxt.FromResponse(resp)
+	file.StatusCode = resp.StatusCode
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxRobotsSize))
 		if err != nil {
-			// Empty robots.txt on parse error
-			robotsData, _ = robotstxt.FromStatusAndString(statusCode, "")
+			file.StatusCode = 0
+			file.ExpiresAt = now.Add(rc.cfg.NetworkErrorTTL)
+			return file, fmt.Errorf("failed to read robots.txt: %w", err)
 		}
-	} else {
-		// Create an empty robots.txt for non-2xx responses
-		robotsData, _ = robotstxt.FromStatusAndString(statusCode, "")
+		file.Body = string(body)
+		file.ExpiresAt = now.Add(rc.cfg.SuccessTTL)
+	case resp.StatusCode >= 500:
+		file.ExpiresAt = now.Add(rc.cfg.ServerErrorTTL)
+	default:
+		file.ExpiresAt = now.Add(rc.cfg.ClientErrorTTL)
 	}
+	return file, nil
+}
 
-	entry = &robotsEntry{
-		data:       robotsData,
-		fetchedAt:  time.Now(),
-		statusCode: statusCode,
+// newRobotsEntry parses a robots.txt file. As RFC 9309 asks, an unreachable file (a
+// 5xx answer or a failed fetch) disallows everything and any other answer without a
+// usable file allows everything.
+func newRobotsEntry(file *RobotsFile) *robotsEntry {
+	data, _ := robotstxt.FromStatusAndString(http.StatusNotFound, "") // Allows everything
+	switch {
+	case file.StatusCode >= 200 && file.StatusCode < 300:
+		if parsed, err := robotstxt.FromString(file.Body); err == nil {
+			data = parsed
+		}
+	case file.StatusCode == 0, file.StatusCode >= 500 && file.StatusCode < 600:
+		data, _ = robotstxt.FromStatusAndString(http.StatusServiceUnavailable, "") // Disallows everything
 	}
 
-	rc.mu.Lock()
-	rc.cache[host] = entry
-	rc.mu.Unlock()
-
-	return entry, nil
+	return &robotsEntry{
+		data:       data,
+		fetchedAt:  file.FetchedAt,
+		expiresAt:  file.ExpiresAt,
+		statusCode: file.StatusCode,
+	}
 }
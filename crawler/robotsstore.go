@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/config"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultRobotsPrefix = "scraper:robots:" // Followed by the origin, e.g. "https://example.com"
+
+	memoryRobotsPruneEvery = 1000 // Puts between sweeps of expired files in the memory store
+)
+
+// RobotsFile is the outcome of fetching a robots.txt, as shared between nodes
+type RobotsFile struct {
+	StatusCode int       `json:"status_code"`    // 0 when the fetch failed
+	Body       string    `json:"body,omitempty"` // Only kept for 2xx answers
+	FetchedAt  time.Time `json:"fetched_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// RobotsStore caches robots.txt files by origin. Get returns nil without an error
+// when the origin isn't cached or its file has expired.
+type RobotsStore interface {
+	Get(ctx context.Context, origin string) (*RobotsFile, error)
+	Put(ctx context.Context, origin string, file RobotsFile) error
+	Close() error
+}
+
+// MemoryRobotsStore implements RobotsStore for a single process
+type MemoryRobotsStore struct {
+	mu    sync.Mutex
+	files map[string]RobotsFile
+	puts  int
+}
+
+// NewMemoryRobotsStore creates an in-memory robots.txt store
+func NewMemoryRobotsStore() RobotsStore {
+	return &MemoryRobotsStore{files: make(map[string]RobotsFile)}
+}
+
+// Get returns the cached file of an origin
+func (s *MemoryRobotsStore) Get(ctx context.Context, origin string) (*RobotsFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, ok := s.files[origin]
+	if !ok {
+		return nil, nil
+	}
+	if !time.Now().Before(file.ExpiresAt) {
+		delete(s.files, origin)
+		return nil, nil
+	}
+	return &file, nil
+}
+
+// Put caches the file of an origin until it expires
+func (s *MemoryRobotsStore) Put(ctx context.Context, origin string, file RobotsFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.puts++
+	if s.puts%memoryRobotsPruneEvery == 0 {
+		now := time.Now()
+		for cached, f := range s.files {
+			if !now.Before(f.ExpiresAt) {
+				delete(s.files, cached)
+			}
+		}
+	}
+	s.files[origin] = file
+	return nil
+}
+
+// Close is a no-op for the memory store
+func (s *MemoryRobotsStore) Close() error {
+	return nil
+}
+
+// RedisRobotsStore implements RobotsStore with expiring Redis keys shared by every node
+type RedisRobotsStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisRobotsStore creates a new Redis-based robots.txt store
+func NewRedisRobotsStore(cfg config.RedisConfig) (RobotsStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address(),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	// Ping Redis to ensure connection is established
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	return &RedisRobotsStore{
+		client: client,
+		prefix: defaultRobotsPrefix,
+	}, nil
+}
+
+// Get returns the cached file of an origin
+func (s *RedisRobotsStore) Get(ctx context.Context, origin string) (*RobotsFile, error) {
+	value, err := s.client.Get(ctx, s.prefix+origin).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get robots.txt of %s: %w", origin, err)
+	}
+
+	var file RobotsFile
+	if err := json.Unmarshal([]byte(value), &file); err != nil {
+		return nil, fmt.Errorf("failed to decode robots.txt of %s: %w", origin, err)
+	}
+	return &file, nil
+}
+
+// Put caches the file of an origin, the key expires with it
+func (s *RedisRobotsStore) Put(ctx context.Context, origin string, file RobotsFile) error {
+	ttl := time.Until(file.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	value, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to encode robots.txt of %s: %w", origin, err)
+	}
+	if err := s.client.Set(ctx, s.prefix+origin, value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store robots.txt of %s: %w", origin, err)
+	}
+	return nil
+}
+
+// Close closes the Redis connection
+func (s *RedisRobotsStore) Close() error {
+	return s.client.Close()
+}
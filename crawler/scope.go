@@ -0,0 +1,284 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/config"
+	"github.com/MunishMummadi/web-scrapper/queue"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// Scope modes
+	ScopeHost   = "host"   // Only URLs on one of the seed hosts
+	ScopeDomain = "domain" // Only URLs under one of the seeds' registered domains
+	ScopeAny    = "any"    // Any host, only the other rules apply
+
+	// Frontier decisions
+	DecisionEnqueued = "enqueued"
+	DecisionDropped  = "dropped"
+
+	// Reasons recorded alongside a decision
+	ReasonSeed            = "seed"
+	ReasonInScope         = "in_scope"
+	ReasonMaxDepth        = "max_depth"
+	ReasonMaxPages        = "max_pages"
+	ReasonMaxPagesPerHost = "max_pages_per_host"
+	ReasonOffHost         = "off_host"
+	ReasonOffDomain       = "off_domain"
+	ReasonExcluded        = "excluded"
+	ReasonNotIncluded     = "not_included"
+	ReasonPathPrefix      = "path_prefix"
+	ReasonDuplicate       = "duplicate"
+	ReasonRecrawl         = "recrawl"
+	ReasonJobCancelled    = "job_cancelled"
+	ReasonEnqueueFailed   = "enqueue_failed"
+
+	// How long an idle crawl is kept in memory before it is forgotten
+	crawlIdleExpiry = 24 * time.Hour
+)
+
+// CrawlOptions are the guardrails and queue priorities applied to a single crawl
+type CrawlOptions struct {
+	MaxDepth        int                `json:"max_depth"`
+	MaxPages        int                `json:"max_pages"`
+	MaxPagesPerHost int                `json:"max_pages_per_host"`
+	Scope           config.ScopeConfig `json:"scope"`
+	Priority        queue.Priority     `json:"priority"`      // Queue priority of the seeds
+	LinkPriority    queue.Priority     `json:"link_priority"` // Queue priority of discovered links
+}
+
+// DefaultCrawlOptions builds crawl options from the crawler configuration
+func DefaultCrawlOptions(cfg *config.CrawlerConfig) CrawlOptions {
+	return CrawlOptions{
+		MaxDepth:        cfg.MaxDepth,
+		MaxPages:        cfg.MaxPagesPerCrawl,
+		MaxPagesPerHost: cfg.MaxPagesPerHost,
+		Priority:        queue.PriorityOperator,
+		LinkPriority:    queue.PriorityDiscovered,
+		Scope: config.ScopeConfig{
+			Mode:         cfg.Scope.Mode,
+			Include:      append([]string(nil), cfg.Scope.Include...),
+			Exclude:      append([]string(nil), cfg.Scope.Exclude...),
+			PathPrefixes: append([]string(nil), cfg.Scope.PathPrefixes...),
+		},
+	}
+}
+
+// crawlState holds the compiled scope rules and page budget of a running crawl
+type crawlState struct {
+	id          string
+	opts        CrawlOptions
+	include     []*regexp.Regexp
+	exclude     []*regexp.Regexp
+	seedHosts   map[string]struct{}
+	seedDomains map[string]struct{}
+
+	mu           sync.Mutex
+	pages        int
+	hostPages    map[string]int
+	job          bool      // Tracked as a crawl job in storage
+	status       string    // Status of the job
+	statusAt     time.Time // When status was last read or changed
+	seeding      bool      // The seeds are still being enqueued, so the job can't be complete yet
+	lastActivity time.Time
+}
+
+// ValidateCrawlOptions checks crawl options without starting a crawl
+func ValidateCrawlOptions(opts CrawlOptions) error {
+	_, err := newCrawlState("", opts, nil)
+	return err
+}
+
+// newCrawlState validates the options and compiles the scope rules for a crawl
+func newCrawlState(id string, opts CrawlOptions, seeds []*url.URL) (*crawlState, error) {
+	switch opts.Scope.Mode {
+	case "":
+		opts.Scope.Mode = ScopeDomain
+	case ScopeHost, ScopeDomain, ScopeAny:
+	default:
+		return nil, fmt.Errorf("invalid scope mode %q", opts.Scope.Mode)
+	}
+	if opts.MaxDepth < 0 || opts.MaxPages < 0 || opts.MaxPagesPerHost < 0 {
+		return nil, fmt.Errorf("crawl limits cannot be negative")
+	}
+
+	include, err := compilePatterns(opts.Scope.Include)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include pattern: %w", err)
+	}
+	exclude, err := compilePatterns(opts.Scope.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exclude pattern: %w", err)
+	}
+
+	state := &crawlState{
+		id:           id,
+		opts:         opts,
+		include:      include,
+		exclude:      exclude,
+		seedHosts:    make(map[string]struct{}),
+		seedDomains:  make(map[string]struct{}),
+		hostPages:    make(map[string]int),
+		lastActivity: time.Now(),
+	}
+	for _, seed := range seeds {
+		state.addSeed(seed)
+	}
+	return state, nil
+}
+
+// addSeed widens the crawl scope to include the seed's host and domain
+func (s *crawlState) addSeed(seed *url.URL) {
+	host := strings.ToLower(seed.Hostname())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seedHosts[host] = struct{}{}
+	s.seedDomains[registeredDomain(host)] = struct{}{}
+}
+
+// admit decides whether a URL discovered at the given depth may join the crawl.
+// Seeds bypass the scope rules but still count against the page budget.
+// Admitted URLs are charged to the budget immediately.
+func (s *crawlState) admit(u *url.URL, depth int, seed bool) (string, string) {
+	host := strings.ToLower(u.Hostname())
+
+	if !seed {
+		if depth > s.opts.MaxDepth {
+			return DecisionDropped, ReasonMaxDepth
+		}
+		if reason := s.checkScope(u, host); reason != "" {
+			return DecisionDropped, reason
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastActivity = time.Now()
+
+	if s.opts.MaxPages > 0 && s.pages >= s.opts.MaxPages {
+		return DecisionDropped, ReasonMaxPages
+	}
+	if s.opts.MaxPagesPerHost > 0 && s.hostPages[host] >= s.opts.MaxPagesPerHost {
+		return DecisionDropped, ReasonMaxPagesPerHost
+	}
+	s.pages++
+	s.hostPages[host]++
+
+	if seed {
+		return DecisionEnqueued, ReasonSeed
+	}
+	return DecisionEnqueued, ReasonInScope
+}
+
+// release returns a budget slot taken by admit when the URL never made it onto the queue
+func (s *crawlState) release(u *url.URL) {
+	host := strings.ToLower(u.Hostname())
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pages > 0 {
+		s.pages--
+	}
+	if s.hostPages[host] > 0 {
+		s.hostPages[host]--
+	}
+}
+
+// resetBudget starts the page budget over, as if nothing had been admitted yet
+func (s *crawlState) resetBudget() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages = 0
+	s.hostPages = make(map[string]int)
+	s.lastActivity = time.Now()
+}
+
+// checkScope returns the reason a URL falls outside the crawl scope, or "" if it is in scope
+func (s *crawlState) checkScope(u *url.URL, host string) string {
+	s.mu.Lock()
+	switch s.opts.Scope.Mode {
+	case ScopeHost:
+		if _, ok := s.seedHosts[host]; !ok {
+			s.mu.Unlock()
+			return ReasonOffHost
+		}
+	case ScopeDomain:
+		if _, ok := s.seedDomains[registeredDomain(host)]; !ok {
+			s.mu.Unlock()
+			return ReasonOffDomain
+		}
+	}
+	s.mu.Unlock()
+
+	if len(s.opts.Scope.PathPrefixes) > 0 {
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		matched := false
+		for _, prefix := range s.opts.Scope.PathPrefixes {
+			if strings.HasPrefix(path, prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return ReasonPathPrefix
+		}
+	}
+
+	urlStr := u.String()
+	for _, re := range s.exclude {
+		if re.MatchString(urlStr) {
+			return ReasonExcluded
+		}
+	}
+	if len(s.include) > 0 {
+		for _, re := range s.include {
+			if re.MatchString(urlStr) {
+				return ""
+			}
+		}
+		return ReasonNotIncluded
+	}
+
+	return ""
+}
+
+// idleSince reports when the crawl last admitted or was asked to admit a URL
+func (s *crawlState) idleSince() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastActivity
+}
+
+// compilePatterns compiles a list of regular expressions
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// registeredDomain returns the eTLD+1 of a host, falling back to the host itself
+// for IP addresses, localhost and other names without a public suffix
+func registeredDomain(host string) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
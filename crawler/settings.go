@@ -0,0 +1,164 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/config"
+)
+
+const settingsKey = "crawler" // Storage key the runtime settings are persisted under
+
+// Settings are the crawler options that can be changed while it runs
+type Settings struct {
+	WorkerCount   int           `json:"worker_count"`
+	UserAgent     string        `json:"user_agent"`
+	RespectRobots bool          `json:"respect_robots"`
+	DefaultDelay  time.Duration `json:"default_delay"` // Minimum spacing between requests to one host
+	MaxRetries    int           `json:"max_retries"`
+	RetryDelay    time.Duration `json:"retry_delay"` // Backoff before the first retry, doubled for every further one
+}
+
+// SettingsError lists the invalid fields of a settings update with the reason each was rejected
+type SettingsError struct {
+	Fields map[string]string
+}
+
+func (e *SettingsError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	reasons := make([]string, 0, len(fields))
+	for _, field := range fields {
+		reasons = append(reasons, field+": "+e.Fields[field])
+	}
+	return "invalid settings: " + strings.Join(reasons, ", ")
+}
+
+// settingsFromConfig takes the runtime settings from the crawler config
+func settingsFromConfig(cfg *config.CrawlerConfig) Settings {
+	return Settings{
+		WorkerCount:   cfg.WorkerCount,
+		UserAgent:     cfg.UserAgent,
+		RespectRobots: cfg.RespectRobots,
+		DefaultDelay:  cfg.DefaultDelay,
+		MaxRetries:    cfg.MaxRetries,
+		RetryDelay:    cfg.RetryDelay,
+	}
+}
+
+// Validate checks the settings and returns a *SettingsError naming every invalid field
+func (s Settings) Validate() error {
+	fields := make(map[string]string)
+	if s.WorkerCount < 1 {
+		fields["worker_count"] = "must be at least 1"
+	}
+	if strings.TrimSpace(s.UserAgent) == "" {
+		fields["user_agent"] = "cannot be empty"
+	}
+	if s.DefaultDelay <= 0 {
+		fields["default_delay"] = "must be greater than 0"
+	}
+	if s.MaxRetries < 0 {
+		fields["max_retries"] = "cannot be negative"
+	}
+	if s.RetryDelay < 0 {
+		fields["retry_delay"] = "cannot be negative"
+	}
+	if len(fields) > 0 {
+		return &SettingsError{Fields: fields}
+	}
+	return nil
+}
+
+// Settings returns the settings the crawler is running with
+func (c *Crawler) Settings() Settings {
+	c.settingsMu.RLock()
+	defer c.settingsMu.RUnlock()
+	return c.settings
+}
+
+// LoadSettings applies the settings persisted by an earlier UpdateSettings over the configured ones.
+// Call it before Start.
+func (c *Crawler) LoadSettings(ctx context.Context) error {
+	c.settingsUpdateMu.Lock()
+	defer c.settingsUpdateMu.Unlock()
+
+	value, err := c.storage.GetSetting(ctx, settingsKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load crawler settings: %w", err)
+	}
+
+	// Fields missing from the stored settings keep their configured values
+	settings := c.Settings()
+	if err := json.Unmarshal([]byte(value), &settings); err != nil {
+		return fmt.Errorf("failed to decode crawler settings: %w", err)
+	}
+	if err := settings.Validate(); err != nil {
+		log.Printf("Ignoring stored crawler settings: %v", err)
+		return nil
+	}
+
+	c.applySettings(settings)
+	log.Printf("Loaded crawler settings: %d workers, user agent %q, default delay %v", settings.WorkerCount, settings.UserAgent, settings.DefaultDelay)
+	return nil
+}
+
+// UpdateSettings derives new settings from the current ones with update, validates and
+// persists them, then applies them. Updates run one at a time, so concurrent partial
+// updates never overwrite each other's fields. Tasks being fetched finish with the
+// settings they started with; workers removed by a lower worker count stop once their
+// current task is done.
+func (c *Crawler) UpdateSettings(ctx context.Context, update func(Settings) (Settings, error)) (Settings, error) {
+	c.settingsUpdateMu.Lock()
+	defer c.settingsUpdateMu.Unlock()
+
+	settings, err := update(c.Settings())
+	if err != nil {
+		return Settings{}, err
+	}
+	if err := settings.Validate(); err != nil {
+		return Settings{}, err
+	}
+
+	value, err := json.Marshal(settings)
+	if err != nil {
+		return Settings{}, fmt.Errorf("failed to encode crawler settings: %w", err)
+	}
+	if err := c.storage.SaveSetting(ctx, settingsKey, string(value)); err != nil {
+		return Settings{}, err
+	}
+
+	c.applySettings(settings)
+	log.Printf("Updated crawler settings: %d workers, user agent %q, respect robots %t, default delay %v, %d retries after %v",
+		settings.WorkerCount, settings.UserAgent, settings.RespectRobots, settings.DefaultDelay, settings.MaxRetries, settings.RetryDelay)
+	return settings, nil
+}
+
+// applySettings switches the crawler and its components to the settings
+func (c *Crawler) applySettings(settings Settings) {
+	c.settingsMu.Lock()
+	defer c.settingsMu.Unlock()
+
+	c.settings = settings
+	c.robots.SetUserAgent(settings.UserAgent)
+	c.rateLimiter.SetDefaultRate(1.0 / settings.DefaultDelay.Seconds())
+	workers := settings.WorkerCount
+	if c.autoscaler != nil {
+		workers = c.autoscaler.clamp(workers) // The autoscaler takes it from there
+	}
+	c.SetWorkerCount(workers)
+}
@@ -0,0 +1,180 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/database"
+	"github.com/MunishMummadi/web-scrapper/queue"
+)
+
+const (
+	maxSitemapURLs = 50000    // Entries read from one sitemap, as allowed by the protocol
+	maxSitemapSize = 50 << 20 // Uncompressed bytes read from one sitemap, as allowed by the protocol
+)
+
+// errSitemapTooLarge is returned when a sitemap is larger than maxSitemapSize uncompressed
+var errSitemapTooLarge = errors.New("sitemap exceeds 50MB")
+
+// lastModLayouts are the W3C datetime forms a <lastmod> may take
+var lastModLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02", "2006-01", "2006"}
+
+// sitemapEntry is a <url> of a sitemap or a <sitemap> of a sitemap index
+type sitemapEntry struct {
+	loc      string
+	lastMod  time.Time
+	priority float64
+	sitemap  bool // The entry is itself a sitemap to expand
+}
+
+// StartSitemapCrawl starts a crawl job seeded with sitemaps or sitemap indexes. Workers
+// expand them, sitemaps listed in an index are expanded in turn, and every page URL
+// they list is enqueued at the sitemap priority within the job's options.
+func (c *Crawler) StartSitemapCrawl(ctx context.Context, sitemaps []string, opts CrawlOptions) (string, error) {
+	return c.startCrawl(ctx, sitemaps, opts, true)
+}
+
+// expandSitemap streams a fetched sitemap or sitemap index and enqueues its entries
+// in the crawl of the task, at the task's depth
+func (c *Crawler) expandSitemap(ctx context.Context, task *queue.Task, resp *http.Response) error {
+	crawl := c.crawlForTask(ctx, task)
+
+	pages, sitemaps, enqueued := 0, 0, 0
+	entries, err := parseSitemap(resp.Body, func(entry sitemapEntry) {
+		if entry.sitemap {
+			sitemaps++
+		} else {
+			pages++
+		}
+		entryURL, err := url.Parse(entry.loc)
+		if err != nil || (entryURL.Scheme != "http" && entryURL.Scheme != "https") {
+			return
+		}
+		ok, err := c.enqueueInCrawl(ctx, crawl, entryURL, task.URL, task.Depth, false, &entry)
+		if err != nil {
+			log.Printf("Error enqueuing %s from sitemap %s: %v", entry.loc, task.URL, err)
+			return
+		}
+		if ok {
+			enqueued++
+		}
+	})
+	if entries >= maxSitemapURLs {
+		log.Printf("Stopped reading sitemap %s after %d URLs", task.URL, maxSitemapURLs)
+	}
+	log.Printf("Expanded sitemap %s: %d URLs and %d sitemaps, enqueued %d", task.URL, pages, sitemaps, enqueued)
+	var syntaxErr *xml.SyntaxError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &syntaxErr), errors.Is(err, errSitemapTooLarge), errors.Is(err, gzip.ErrHeader):
+		// What was read so far stays enqueued, retrying would only read the same document again
+		return policyError(true, fmt.Errorf("invalid sitemap: %w", err))
+	default:
+		return classifyError(fmt.Errorf("failed to read sitemap: %w", err))
+	}
+}
+
+// parseSitemap decodes a sitemap or sitemap index, gzipped or not, one entry at a
+// time so a large sitemap is never held in memory. It stops after maxSitemapURLs
+// entries and returns the number of entries read.
+func parseSitemap(r io.Reader, fn func(sitemapEntry)) (int, error) {
+	buffered := bufio.NewReader(r)
+	var body io.Reader = buffered
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return 0, fmt.Errorf("invalid gzip stream: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	decoder := xml.NewDecoder(&limitedReader{r: body, remaining: maxSitemapSize})
+	entries := 0
+	for entries < maxSitemapURLs {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return entries, err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || (start.Name.Local != "url" && start.Name.Local != "sitemap") {
+			continue
+		}
+		var element struct {
+			Loc      string `xml:"loc"`
+			LastMod  string `xml:"lastmod"`
+			Priority string `xml:"priority"`
+		}
+		if err := decoder.DecodeElement(&element, &start); err != nil {
+			return entries, err
+		}
+		entries++
+
+		entry := sitemapEntry{
+			loc:     strings.TrimSpace(element.Loc),
+			lastMod: parseLastMod(element.LastMod),
+			sitemap: start.Name.Local == "sitemap",
+		}
+		if priority, err := strconv.ParseFloat(strings.TrimSpace(element.Priority), 64); err == nil && priority >= 0 && priority <= 1 {
+			entry.priority = priority
+		}
+		if entry.loc != "" {
+			fn(entry)
+		}
+	}
+	return entries, nil
+}
+
+// parseLastMod parses a <lastmod> value, returning the zero time when it is missing or invalid
+func parseLastMod(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	for _, layout := range lastModLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// unchangedSince reports whether a stored page was scraped after the <lastmod> of the
+// sitemap entry it was enqueued from, so fetching it again would bring nothing new
+func unchangedSince(page database.Page, task *queue.Task) bool {
+	return !task.LastMod.IsZero() && page.ScrapedAt.After(task.LastMod)
+}
+
+// limitedReader reads up to remaining bytes and fails with errSitemapTooLarge past them
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, errSitemapTooLarge
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,165 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/queue"
+)
+
+const statsInterval = 15 * time.Second // How often the stats gauges are refreshed
+
+// statsWindows are the sliding windows rates are reported over
+var statsWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// Stats is a snapshot of the crawler's live state
+type Stats struct {
+	Queue          queue.Stats
+	WorkerPool     int                // Workers in the pool, as sized by the settings or the autoscaler
+	WorkersRunning int                // Worker goroutines alive, including removed ones finishing their task
+	WorkersBusy    int                // Workers of this process handling a task right now
+	PagesPerMinute map[string]float64 // Pages fetched per minute, by window ("1m", "5m", "15m")
+	ErrorRate      map[string]float64 // Share of fetch attempts that failed, by window
+	OpenCircuits   int
+	ThrottledHosts int // Hosts the auto-throttle runs slower than the default rate
+	HealthyProxies int
+	Proxies        int
+}
+
+// rateCounter counts events in one-second buckets over a sliding span of time
+type rateCounter struct {
+	mu      sync.Mutex
+	buckets []int
+	seconds []int64 // The unix second each bucket currently counts
+}
+
+func newRateCounter(span time.Duration) *rateCounter {
+	n := int(span / time.Second)
+	return &rateCounter{
+		buckets: make([]int, n),
+		seconds: make([]int64, n),
+	}
+}
+
+// add counts an event at now
+func (r *rateCounter) add(now time.Time) {
+	second := now.Unix()
+	i := int(second % int64(len(r.buckets)))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seconds[i] != second {
+		r.seconds[i] = second
+		r.buckets[i] = 0
+	}
+	r.buckets[i]++
+}
+
+// count returns the number of events in the window ending at now
+func (r *rateCounter) count(now time.Time, window time.Duration) int {
+	cutoff := now.Add(-window).Unix()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total := 0
+	for i, second := range r.seconds {
+		if second > cutoff && second <= now.Unix() {
+			total += r.buckets[i]
+		}
+	}
+	return total
+}
+
+// windowLabel names a stats window, e.g. "5m"
+func windowLabel(window time.Duration) string {
+	return fmt.Sprintf("%dm", int(window.Minutes()))
+}
+
+// recordFetch counts a fetch attempt for the crawl rate and error rate
+func (c *Crawler) recordFetch(failed bool) {
+	now := time.Now()
+	if failed {
+		c.fetchFailures.add(now)
+	} else {
+		c.fetches.add(now)
+	}
+}
+
+// Stats returns a snapshot of the queue, workers, crawl and error rates, circuits and proxies
+func (c *Crawler) Stats(ctx context.Context) (Stats, error) {
+	queueStats, err := c.queue.Stats(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	c.statsMu.Lock()
+	startedAt := c.startedAt
+	c.statsMu.Unlock()
+
+	stats := Stats{
+		Queue:          queueStats,
+		WorkerPool:     c.WorkerCount(),
+		WorkersRunning: int(c.running.Load()),
+		WorkersBusy:    int(c.busy.Load()),
+		PagesPerMinute: make(map[string]float64, len(statsWindows)),
+		ErrorRate:      make(map[string]float64, len(statsWindows)),
+		OpenCircuits:   c.circuitBreaker.OpenCircuits(),
+	}
+	if c.throttle != nil {
+		stats.ThrottledHosts = c.throttle.throttledCount()
+	}
+	if c.proxyManager != nil {
+		stats.HealthyProxies, stats.Proxies = c.proxyManager.Counts()
+	}
+
+	now := time.Now()
+	for _, window := range statsWindows {
+		label := windowLabel(window)
+		fetched := c.fetches.count(now, window)
+		failed := c.fetchFailures.count(now, window)
+
+		// Don't average over time the crawler wasn't running yet
+		span := window
+		if !startedAt.IsZero() && now.Sub(startedAt) < span {
+			span = now.Sub(startedAt)
+		}
+		if span >= time.Second {
+			stats.PagesPerMinute[label] = float64(fetched) / span.Minutes()
+		}
+		if fetched+failed > 0 {
+			stats.ErrorRate[label] = float64(failed) / float64(fetched+failed)
+		}
+	}
+	return stats, nil
+}
+
+// reportStats periodically refreshes the queue size, open circuits and healthy proxies gauges
+func (c *Crawler) reportStats(ctx context.Context) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			statsCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			stats, err := c.Stats(statsCtx)
+			cancel()
+			if err != nil {
+				log.Printf("Error collecting crawler stats: %v", err)
+				continue
+			}
+			c.metrics.SetQueueSize(stats.Queue.Len())
+			c.metrics.SetOpenCircuits(stats.OpenCircuits)
+			c.metrics.SetHealthyProxies(stats.HealthyProxies)
+		}
+	}
+}
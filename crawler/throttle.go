@@ -0,0 +1,147 @@
+package crawler
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/config"
+)
+
+// hostThrottle is the adapted request spacing of one host
+type hostThrottle struct {
+	delay     time.Duration
+	successes int // Successful responses since the delay last changed
+}
+
+// autoThrottle adapts each host's request rate in the rate limiter, AutoThrottle
+// style. A 429 or 503 doubles the host's delay; successful responses move it
+// halfway towards latency / targetConcurrency, right away when that is slower
+// and only after recoverAfter responses in a row when it is faster. Hosts are
+// never sped up past the default delay, and go back to the default rate once
+// they have recovered.
+type autoThrottle struct {
+	limiter *HostRateLimiter
+	cfg     config.ThrottleConfig
+
+	mu    sync.Mutex
+	hosts map[string]*hostThrottle // Hosts running slower than the default rate
+}
+
+func newAutoThrottle(limiter *HostRateLimiter, cfg config.ThrottleConfig) *autoThrottle {
+	if cfg.TargetConcurrency <= 0 {
+		cfg.TargetConcurrency = 1
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = time.Minute
+	}
+	if cfg.RecoverAfter < 1 {
+		cfg.RecoverAfter = 1
+	}
+	return &autoThrottle{
+		limiter: limiter,
+		cfg:     cfg,
+		hosts:   make(map[string]*hostThrottle),
+	}
+}
+
+// throttled slows a host down after it answered 429 or 503
+func (t *autoThrottle) throttled(host string, defaultDelay time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.hosts[host]
+	if !ok {
+		state = &hostThrottle{delay: defaultDelay}
+		t.hosts[host] = state
+	}
+	state.delay = t.bound(state.delay*2, defaultDelay)
+	state.successes = 0
+	t.limiter.SetRate(host, 1/state.delay.Seconds(), 1)
+	log.Printf("Throttling %s to one request every %v", host, state.delay)
+}
+
+// observe adapts a host's delay to the latency of a successful response
+func (t *autoThrottle) observe(host string, latency, defaultDelay time.Duration) {
+	target := t.bound(time.Duration(float64(latency)/t.cfg.TargetConcurrency), defaultDelay)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.hosts[host]
+	if !ok {
+		if target <= defaultDelay {
+			return // Running at the default rate and fast enough for it
+		}
+		state = &hostThrottle{delay: defaultDelay}
+		t.hosts[host] = state
+	}
+
+	state.successes++
+	switch {
+	case target > state.delay:
+		// The host is slowing down, follow it
+	case state.successes >= t.cfg.RecoverAfter:
+		// Sustained success, speed back up
+	default:
+		return
+	}
+	state.delay = (state.delay + target) / 2
+	state.successes = 0
+
+	// Close enough to the default rate, hand the host back to it
+	if state.delay-defaultDelay <= defaultDelay/20 {
+		delete(t.hosts, host)
+		t.limiter.ResetRate(host)
+		log.Printf("Throttling of %s lifted", host)
+		return
+	}
+	t.limiter.SetRate(host, 1/state.delay.Seconds(), 1)
+}
+
+// bound keeps a delay between the default delay and the maximum delay
+func (t *autoThrottle) bound(delay, defaultDelay time.Duration) time.Duration {
+	if delay < defaultDelay {
+		return defaultDelay
+	}
+	if delay > t.cfg.MaxDelay && t.cfg.MaxDelay > defaultDelay {
+		return t.cfg.MaxDelay
+	}
+	return delay
+}
+
+// throttledCount returns the number of hosts running slower than the default rate
+func (t *autoThrottle) throttledCount() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.hosts)
+}
+
+// isThrottling reports whether a status asks the crawler to slow down
+func isThrottling(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := date.Sub(now); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
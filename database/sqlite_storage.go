@@ -3,9 +3,13 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/MunishMummadi/web-scrapper/config"
@@ -14,11 +18,40 @@ import (
 
 // Storage defines the interface for data persistence
 type Storage interface {
-	SaveScrapedData(ctx context.Context, url string, scrapedAt time.Time, contentHash string) error
+	SaveScrapedData(ctx context.Context, page Page) error
 	GetLastScrapeTime(ctx context.Context, url string) (time.Time, error)
+	GetPage(ctx context.Context, url string) (Page, error)
 	GetScrapedPages(ctx context.Context, limit int) ([]Page, error)
 	GetScrapedPagesCount(ctx context.Context) (int, error)
 	GetScrapedPagesPaginated(ctx context.Context, limit int, offset int) ([]Page, error)
+	DeletePage(ctx context.Context, url string) ([]string, error)
+	SaveURLDecisions(ctx context.Context, decisions []URLDecision) error
+	PruneURLDecisions(ctx context.Context, before time.Time) (int64, error)
+	GetURLDecisions(ctx context.Context, crawlID string, limit int) ([]URLDecision, error)
+	SavePageVersion(ctx context.Context, version PageVersion) (PageVersion, error)
+	GetPageVersions(ctx context.Context, url string, limit int) ([]PageVersion, error)
+	GetPageVersion(ctx context.Context, id int64) (PageVersion, error)
+	SaveRecrawlSchedule(ctx context.Context, schedule RecrawlSchedule) error
+	GetRecrawlSchedule(ctx context.Context, url string) (RecrawlSchedule, error)
+	GetDueRecrawls(ctx context.Context, now time.Time, limit int) ([]RecrawlSchedule, error)
+	PostponeRecrawl(ctx context.Context, url string, nextVisitAt time.Time) error
+	SaveCrawlSchedule(ctx context.Context, schedule CrawlSchedule) error
+	GetCrawlSchedule(ctx context.Context, name string) (CrawlSchedule, error)
+	GetCrawlSchedules(ctx context.Context) ([]CrawlSchedule, error)
+	DeleteCrawlSchedule(ctx context.Context, name string) error
+	UpdateCrawlScheduleRun(ctx context.Context, name string, lastRunAt, nextRunAt time.Time, crawlID string) error
+	UpdateCrawlScheduleNextRun(ctx context.Context, name string, nextRunAt time.Time) error
+	SaveCrawlJob(ctx context.Context, job CrawlJob) error
+	GetCrawlJob(ctx context.Context, id string) (CrawlJob, error)
+	GetCrawlJobs(ctx context.Context, status string, limit int, offset int) ([]CrawlJob, error)
+	GetCrawlJobsCount(ctx context.Context, status string) (int, error)
+	UpdateCrawlJobCounts(ctx context.Context, id, node string, delta CrawlJobCounts) (CrawlJob, error)
+	GetCrawlJobsInFlight(ctx context.Context, node string) (map[string]int, error)
+	UpdateCrawlJobStatus(ctx context.Context, id string, status string, finishedAt time.Time, from ...string) (bool, error)
+	ParkCrawlJobTasks(ctx context.Context, id string, tasks []string) error
+	TakeCrawlJobTasks(ctx context.Context, id string) ([]string, error)
+	GetSetting(ctx context.Context, key string) (string, error)
+	SaveSetting(ctx context.Context, key string, value string) error
 	Close() error
 }
 
@@ -51,38 +84,223 @@ func NewSQLiteStorage(cfg config.DatabaseConfig) (Storage, error) {
 	CREATE TABLE IF NOT EXISTS scraped_pages (
 		url TEXT PRIMARY KEY,
 		scraped_at TIMESTAMP NOT NULL,
-		content_hash TEXT
+		content_hash TEXT,
+		etag TEXT,
+		last_modified TEXT
 	);
 	CREATE INDEX IF NOT EXISTS idx_scraped_at ON scraped_pages (scraped_at);
+	CREATE TABLE IF NOT EXISTS url_decisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		crawl_id TEXT NOT NULL,
+		url TEXT NOT NULL,
+		parent_url TEXT,
+		depth INTEGER NOT NULL,
+		decision TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		decided_at TIMESTAMP NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_url_decisions_crawl ON url_decisions (crawl_id, decided_at);
+	CREATE INDEX IF NOT EXISTS idx_url_decisions_decided ON url_decisions (decided_at);
+	CREATE TABLE IF NOT EXISTS page_versions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		url TEXT NOT NULL,
+		fetched_at TIMESTAMP NOT NULL,
+		status_code INTEGER NOT NULL,
+		content_hash TEXT,
+		size INTEGER NOT NULL,
+		headers TEXT,
+		changed BOOLEAN NOT NULL DEFAULT 0
+	);
+	CREATE INDEX IF NOT EXISTS idx_page_versions_url ON page_versions (url, fetched_at);
+	CREATE TABLE IF NOT EXISTS recrawl_schedule (
+		url TEXT PRIMARY KEY,
+		interval_ns INTEGER NOT NULL,
+		next_visit_at TIMESTAMP NOT NULL,
+		visits INTEGER NOT NULL DEFAULT 0,
+		changes INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX IF NOT EXISTS idx_recrawl_next_visit ON recrawl_schedule (next_visit_at);
+	CREATE TABLE IF NOT EXISTS crawl_schedules (
+		name TEXT PRIMARY KEY,
+		cron TEXT NOT NULL,
+		seeds TEXT NOT NULL,
+		options TEXT,
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		source TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		last_run_at TIMESTAMP,
+		next_run_at TIMESTAMP,
+		last_crawl_id TEXT
+	);
+	CREATE TABLE IF NOT EXISTS crawl_jobs (
+		id TEXT PRIMARY KEY,
+		seeds TEXT NOT NULL,
+		options TEXT,
+		status TEXT NOT NULL,
+		queued INTEGER NOT NULL DEFAULT 0,
+		in_flight INTEGER NOT NULL DEFAULT 0,
+		succeeded INTEGER NOT NULL DEFAULT 0,
+		failed INTEGER NOT NULL DEFAULT 0,
+		skipped INTEGER NOT NULL DEFAULT 0,
+		started_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_crawl_jobs_started ON crawl_jobs (started_at);
+	CREATE TABLE IF NOT EXISTS crawl_job_nodes (
+		job_id TEXT NOT NULL,
+		node TEXT NOT NULL,
+		in_flight INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (job_id, node)
+	);
+	CREATE TABLE IF NOT EXISTS crawl_job_tasks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_id TEXT NOT NULL,
+		task TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_crawl_job_tasks_job ON crawl_job_tasks (job_id);
+	CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
 	`
 	_, err = db.Exec(query)
 	if err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to create scraped_pages table: %w", err)
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	// Databases created before validators were stored lack their columns
+	for _, column := range []string{"etag", "last_modified"} {
+		if err := addColumn(db, "scraped_pages", column, "TEXT"); err != nil {
+			db.Close()
+			return nil, err
+		}
 	}
 
 	return &SQLiteStorage{db: db}, nil
 }
 
+// addColumn adds a column to an existing table unless it is already there
+func addColumn(db *sql.DB, table, column, columnType string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultValue, &pk); err != nil {
+			return fmt.Errorf("failed to inspect table %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, columnType)); err != nil {
+		return fmt.Errorf("failed to add column %s to %s: %w", column, table, err)
+	}
+	return nil
+}
+
 // Page represents a scraped web page
 type Page struct {
+	URL          string
+	ScrapedAt    time.Time
+	ContentHash  string
+	ETag         string // Validators from the last 2xx response, sent back on recrawls
+	LastModified string
+}
+
+// URLDecision records why a URL was or wasn't admitted to a crawl
+type URLDecision struct {
+	CrawlID   string
+	URL       string
+	ParentURL string
+	Depth     int
+	Decision  string
+	Reason    string
+	DecidedAt time.Time
+}
+
+// PageVersion records a single fetch of a page
+type PageVersion struct {
+	ID          int64
+	URL         string
+	FetchedAt   time.Time
+	StatusCode  int
+	ContentHash string // Empty when no body was kept (e.g. non-2xx responses)
+	Size        int
+	Headers     http.Header
+	Changed     bool // Content hash differs from the previous version that had one
+}
+
+// RecrawlSchedule tracks how often a page changes and when it is due for its next visit
+type RecrawlSchedule struct {
 	URL         string
-	ScrapedAt   time.Time
-	ContentHash string
+	Interval    time.Duration // Current time between visits
+	NextVisitAt time.Time
+	Visits      int // Successful fetches observed
+	Changes     int // Fetches whose content differed from the previous one
+}
+
+// CrawlSchedule is a crawl started repeatedly from the same seeds on a cron schedule
+type CrawlSchedule struct {
+	Name        string
+	Cron        string
+	Seeds       []string
+	Options     string // JSON-encoded crawl option overrides, empty for the defaults
+	Enabled     bool
+	Source      string // Where the schedule is defined: "config" or "api"
+	CreatedAt   time.Time
+	LastRunAt   time.Time // Zero until the schedule has fired
+	NextRunAt   time.Time
+	LastCrawlID string
+}
+
+// CrawlJobCounts tracks the tasks of a crawl job by state
+type CrawlJobCounts struct {
+	Queued    int // Waiting in the queue, or parked while the job is paused
+	InFlight  int // Being fetched
+	Succeeded int
+	Failed    int // Dead-lettered after exhausting their retries
+	Skipped   int // Not fetched: recently scraped, or dropped when the job was cancelled
+}
+
+// CrawlJob is a crawl started from a set of seeds and the progress of its tasks
+type CrawlJob struct {
+	ID      string
+	Seeds   []string
+	Options string // JSON-encoded crawl options
+	Status  string
+	CrawlJobCounts
+	StartedAt  time.Time
+	FinishedAt time.Time // Zero while the job is running or paused
 }
 
 // SaveScrapedData saves metadata about a scraped page
-func (s *SQLiteStorage) SaveScrapedData(ctx context.Context, url string, scrapedAt time.Time, contentHash string) error {
+func (s *SQLiteStorage) SaveScrapedData(ctx context.Context, page Page) error {
 	query := `
-	INSERT INTO scraped_pages (url, scraped_at, content_hash)
-	VALUES (?, ?, ?)
+	INSERT INTO scraped_pages (url, scraped_at, content_hash, etag, last_modified)
+	VALUES (?, ?, ?, ?, ?)
 	ON CONFLICT(url) DO UPDATE SET
 		scraped_at = excluded.scraped_at,
-		content_hash = excluded.content_hash;
+		content_hash = excluded.content_hash,
+		etag = excluded.etag,
+		last_modified = excluded.last_modified;
 	`
-	_, err := s.db.ExecContext(ctx, query, url, scrapedAt, contentHash)
+	_, err := s.db.ExecContext(ctx, query, page.URL, page.ScrapedAt, page.ContentHash, page.ETag, page.LastModified)
 	if err != nil {
-		return fmt.Errorf("failed to save scraped data for url %s: %w", url, err)
+		return fmt.Errorf("failed to save scraped data for url %s: %w", page.URL, err)
 	}
 	return nil
 }
@@ -102,6 +320,25 @@ func (s *SQLiteStorage) GetLastScrapeTime(ctx context.Context, url string) (time
 	return scrapedAt, nil
 }
 
+// GetPage retrieves the latest scrape metadata of a URL.
+// Returns sql.ErrNoRows if the URL has not been scraped.
+func (s *SQLiteStorage) GetPage(ctx context.Context, url string) (Page, error) {
+	query := `SELECT url, scraped_at, content_hash, etag, last_modified FROM scraped_pages WHERE url = ?`
+	var page Page
+	var contentHash, etag, lastModified sql.NullString
+	err := s.db.QueryRowContext(ctx, query, url).Scan(&page.URL, &page.ScrapedAt, &contentHash, &etag, &lastModified)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Page{}, err
+		}
+		return Page{}, fmt.Errorf("failed to get page %s: %w", url, err)
+	}
+	page.ContentHash = contentHash.String
+	page.ETag = etag.String
+	page.LastModified = lastModified.String
+	return page, nil
+}
+
 // GetScrapedPages retrieves a list of scraped pages
 func (s *SQLiteStorage) GetScrapedPages(ctx context.Context, limit int) ([]Page, error) {
 	// Create query with limit
@@ -175,6 +412,748 @@ func (s *SQLiteStorage) GetScrapedPagesPaginated(ctx context.Context, limit int,
 	return pages, nil
 }
 
+// DeletePage removes the scrape data and version history of a page. It returns the
+// content hashes of the page that no other page or version refers to anymore, so
+// their bodies can be deleted too. Deleting a page that isn't stored is a no-op.
+func (s *SQLiteStorage) DeletePage(ctx context.Context, url string) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+	SELECT content_hash FROM scraped_pages WHERE url = ? AND COALESCE(content_hash, '') != ''
+	UNION
+	SELECT content_hash FROM page_versions WHERE url = ? AND COALESCE(content_hash, '') != ''`, url, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query content hashes of %s: %w", url, err)
+	}
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		hashes = append(hashes, hash)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM scraped_pages WHERE url = ?`, url); err != nil {
+		return nil, fmt.Errorf("failed to delete page %s: %w", url, err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM page_versions WHERE url = ?`, url); err != nil {
+		return nil, fmt.Errorf("failed to delete versions of %s: %w", url, err)
+	}
+
+	// Identical bodies are shared, only hand back the ones nothing else uses
+	var orphaned []string
+	for _, hash := range hashes {
+		var used bool
+		err := tx.QueryRowContext(ctx, `SELECT
+		EXISTS (SELECT 1 FROM scraped_pages WHERE content_hash = ?) OR
+		EXISTS (SELECT 1 FROM page_versions WHERE content_hash = ?)`, hash, hash).Scan(&used)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check uses of content %s: %w", hash, err)
+		}
+		if !used {
+			orphaned = append(orphaned, hash)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to delete page %s: %w", url, err)
+	}
+	return orphaned, nil
+}
+
+// SaveURLDecisions records a batch of frontier decisions in one transaction
+func (s *SQLiteStorage) SaveURLDecisions(ctx context.Context, decisions []URLDecision) error {
+	if len(decisions) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+	INSERT INTO url_decisions (crawl_id, url, parent_url, depth, decision, reason, decided_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, decision := range decisions {
+		_, err := stmt.ExecContext(ctx, decision.CrawlID, decision.URL, decision.ParentURL,
+			decision.Depth, decision.Decision, decision.Reason, decision.DecidedAt.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to save decision for url %s: %w", decision.URL, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save %d decisions: %w", len(decisions), err)
+	}
+	return nil
+}
+
+// PruneURLDecisions deletes the frontier decisions made before a time, a chunk at a
+// time so writers aren't locked out for long. It returns the number deleted.
+func (s *SQLiteStorage) PruneURLDecisions(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM url_decisions WHERE id IN
+	(SELECT id FROM url_decisions WHERE decided_at < ? LIMIT 10000)`
+
+	var total int64
+	for {
+		result, err := s.db.ExecContext(ctx, query, before.UTC())
+		if err != nil {
+			return total, fmt.Errorf("failed to prune url decisions: %w", err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("failed to prune url decisions: %w", err)
+		}
+		total += n
+		if n < 10000 {
+			return total, nil
+		}
+	}
+}
+
+// GetURLDecisions retrieves the most recent frontier decisions, optionally filtered by crawl
+func (s *SQLiteStorage) GetURLDecisions(ctx context.Context, crawlID string, limit int) ([]URLDecision, error) {
+	query := `SELECT crawl_id, url, COALESCE(parent_url, ''), depth, decision, reason, decided_at
+	FROM url_decisions WHERE (? = '' OR crawl_id = ?) ORDER BY id DESC LIMIT ?`
+
+	rows, err := s.db.QueryContext(ctx, query, crawlID, crawlID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query url decisions: %w", err)
+	}
+	defer rows.Close()
+
+	var decisions []URLDecision
+	for rows.Next() {
+		var d URLDecision
+		if err := rows.Scan(&d.CrawlID, &d.URL, &d.ParentURL, &d.Depth, &d.Decision, &d.Reason, &d.DecidedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		decisions = append(decisions, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return decisions, nil
+}
+
+// SavePageVersion records a fetch of a page. The version is flagged as changed
+// when it has a content hash that differs from the latest earlier version with one.
+func (s *SQLiteStorage) SavePageVersion(ctx context.Context, version PageVersion) (PageVersion, error) {
+	headers, err := json.Marshal(version.Headers)
+	if err != nil {
+		return version, fmt.Errorf("failed to encode headers for url %s: %w", version.URL, err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return version, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if version.ContentHash != "" {
+		var previousHash string
+		err := tx.QueryRowContext(ctx, `SELECT content_hash FROM page_versions
+		WHERE url = ? AND content_hash != '' ORDER BY fetched_at DESC, id DESC LIMIT 1`, version.URL).Scan(&previousHash)
+		switch {
+		case err == sql.ErrNoRows:
+			version.Changed = false // First version of the page
+		case err != nil:
+			return version, fmt.Errorf("failed to get previous version of url %s: %w", version.URL, err)
+		default:
+			version.Changed = previousHash != version.ContentHash
+		}
+	}
+
+	query := `
+	INSERT INTO page_versions (url, fetched_at, status_code, content_hash, size, headers, changed)
+	VALUES (?, ?, ?, ?, ?, ?, ?);
+	`
+	result, err := tx.ExecContext(ctx, query, version.URL, version.FetchedAt, version.StatusCode,
+		version.ContentHash, version.Size, string(headers), version.Changed)
+	if err != nil {
+		return version, fmt.Errorf("failed to save version of url %s: %w", version.URL, err)
+	}
+	if version.ID, err = result.LastInsertId(); err != nil {
+		return version, fmt.Errorf("failed to get version id: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return version, fmt.Errorf("failed to commit version of url %s: %w", version.URL, err)
+	}
+	return version, nil
+}
+
+// GetPageVersions retrieves the fetch history of a page, most recent first
+func (s *SQLiteStorage) GetPageVersions(ctx context.Context, url string, limit int) ([]PageVersion, error) {
+	query := `SELECT id, url, fetched_at, status_code, COALESCE(content_hash, ''), size, COALESCE(headers, ''), changed
+	FROM page_versions WHERE url = ? ORDER BY fetched_at DESC, id DESC LIMIT ?`
+
+	rows, err := s.db.QueryContext(ctx, query, url, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query page versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []PageVersion
+	for rows.Next() {
+		v, err := scanPageVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return versions, nil
+}
+
+// GetPageVersion retrieves a single version by ID.
+// Returns an error wrapping sql.ErrNoRows if there is no such version.
+func (s *SQLiteStorage) GetPageVersion(ctx context.Context, id int64) (PageVersion, error) {
+	query := `SELECT id, url, fetched_at, status_code, COALESCE(content_hash, ''), size, COALESCE(headers, ''), changed
+	FROM page_versions WHERE id = ?`
+	return scanPageVersion(s.db.QueryRowContext(ctx, query, id))
+}
+
+// rowScanner is a *sql.Row or *sql.Rows positioned on a row
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPageVersion reads a page_versions row selected with the columns of GetPageVersions
+func scanPageVersion(row rowScanner) (PageVersion, error) {
+	var v PageVersion
+	var headers string
+	if err := row.Scan(&v.ID, &v.URL, &v.FetchedAt, &v.StatusCode, &v.ContentHash, &v.Size, &headers, &v.Changed); err != nil {
+		return v, fmt.Errorf("failed to scan row: %w", err)
+	}
+	if headers != "" {
+		if err := json.Unmarshal([]byte(headers), &v.Headers); err != nil {
+			return v, fmt.Errorf("failed to decode headers of version %d: %w", v.ID, err)
+		}
+	}
+	return v, nil
+}
+
+// SaveRecrawlSchedule creates or replaces the recrawl schedule of a page
+func (s *SQLiteStorage) SaveRecrawlSchedule(ctx context.Context, schedule RecrawlSchedule) error {
+	query := `
+	INSERT INTO recrawl_schedule (url, interval_ns, next_visit_at, visits, changes)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(url) DO UPDATE SET
+		interval_ns = excluded.interval_ns,
+		next_visit_at = excluded.next_visit_at,
+		visits = excluded.visits,
+		changes = excluded.changes;
+	`
+	// Stored in UTC so next_visit_at sorts and compares as text
+	_, err := s.db.ExecContext(ctx, query, schedule.URL, int64(schedule.Interval),
+		schedule.NextVisitAt.UTC(), schedule.Visits, schedule.Changes)
+	if err != nil {
+		return fmt.Errorf("failed to save recrawl schedule for url %s: %w", schedule.URL, err)
+	}
+	return nil
+}
+
+// GetRecrawlSchedule retrieves the recrawl schedule of a page.
+// Returns sql.ErrNoRows if the page has no schedule yet.
+func (s *SQLiteStorage) GetRecrawlSchedule(ctx context.Context, url string) (RecrawlSchedule, error) {
+	query := `SELECT url, interval_ns, next_visit_at, visits, changes FROM recrawl_schedule WHERE url = ?`
+	schedule, err := scanRecrawlSchedule(s.db.QueryRowContext(ctx, query, url))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return RecrawlSchedule{}, sql.ErrNoRows
+		}
+		return RecrawlSchedule{}, fmt.Errorf("failed to get recrawl schedule for url %s: %w", url, err)
+	}
+	return schedule, nil
+}
+
+// GetDueRecrawls retrieves the pages whose next visit is due, most overdue first
+func (s *SQLiteStorage) GetDueRecrawls(ctx context.Context, now time.Time, limit int) ([]RecrawlSchedule, error) {
+	query := `SELECT url, interval_ns, next_visit_at, visits, changes FROM recrawl_schedule
+	WHERE next_visit_at <= ? ORDER BY next_visit_at LIMIT ?`
+
+	rows, err := s.db.QueryContext(ctx, query, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due recrawls: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []RecrawlSchedule
+	for rows.Next() {
+		schedule, err := scanRecrawlSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// PostponeRecrawl moves the next visit of a page without touching its statistics
+func (s *SQLiteStorage) PostponeRecrawl(ctx context.Context, url string, nextVisitAt time.Time) error {
+	query := `UPDATE recrawl_schedule SET next_visit_at = ? WHERE url = ?`
+	if _, err := s.db.ExecContext(ctx, query, nextVisitAt.UTC(), url); err != nil {
+		return fmt.Errorf("failed to postpone recrawl of url %s: %w", url, err)
+	}
+	return nil
+}
+
+// scanRecrawlSchedule reads a recrawl_schedule row
+func scanRecrawlSchedule(row rowScanner) (RecrawlSchedule, error) {
+	var schedule RecrawlSchedule
+	var interval int64
+	if err := row.Scan(&schedule.URL, &interval, &schedule.NextVisitAt, &schedule.Visits, &schedule.Changes); err != nil {
+		return schedule, fmt.Errorf("failed to scan row: %w", err)
+	}
+	schedule.Interval = time.Duration(interval)
+	return schedule, nil
+}
+
+// SaveCrawlSchedule creates or replaces a crawl schedule
+func (s *SQLiteStorage) SaveCrawlSchedule(ctx context.Context, schedule CrawlSchedule) error {
+	seeds, err := json.Marshal(schedule.Seeds)
+	if err != nil {
+		return fmt.Errorf("failed to encode seeds of schedule %s: %w", schedule.Name, err)
+	}
+
+	query := `
+	INSERT INTO crawl_schedules (name, cron, seeds, options, enabled, source, created_at, last_run_at, next_run_at, last_crawl_id)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(name) DO UPDATE SET
+		cron = excluded.cron,
+		seeds = excluded.seeds,
+		options = excluded.options,
+		enabled = excluded.enabled,
+		source = excluded.source,
+		last_run_at = excluded.last_run_at,
+		next_run_at = excluded.next_run_at,
+		last_crawl_id = excluded.last_crawl_id;
+	`
+	_, err = s.db.ExecContext(ctx, query, schedule.Name, schedule.Cron, string(seeds), schedule.Options,
+		schedule.Enabled, schedule.Source, schedule.CreatedAt, nullTime(schedule.LastRunAt),
+		nullTime(schedule.NextRunAt), schedule.LastCrawlID)
+	if err != nil {
+		return fmt.Errorf("failed to save schedule %s: %w", schedule.Name, err)
+	}
+	return nil
+}
+
+// GetCrawlSchedule retrieves a crawl schedule by name.
+// Returns sql.ErrNoRows if there is no such schedule.
+func (s *SQLiteStorage) GetCrawlSchedule(ctx context.Context, name string) (CrawlSchedule, error) {
+	query := `SELECT name, cron, seeds, COALESCE(options, ''), enabled, source, created_at, last_run_at, next_run_at,
+	COALESCE(last_crawl_id, '') FROM crawl_schedules WHERE name = ?`
+	schedule, err := scanCrawlSchedule(s.db.QueryRowContext(ctx, query, name))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return CrawlSchedule{}, sql.ErrNoRows
+		}
+		return CrawlSchedule{}, fmt.Errorf("failed to get schedule %s: %w", name, err)
+	}
+	return schedule, nil
+}
+
+// GetCrawlSchedules retrieves every crawl schedule ordered by name
+func (s *SQLiteStorage) GetCrawlSchedules(ctx context.Context) ([]CrawlSchedule, error) {
+	query := `SELECT name, cron, seeds, COALESCE(options, ''), enabled, source, created_at, last_run_at, next_run_at,
+	COALESCE(last_crawl_id, '') FROM crawl_schedules ORDER BY name`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []CrawlSchedule
+	for rows.Next() {
+		schedule, err := scanCrawlSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// DeleteCrawlSchedule removes a crawl schedule.
+// Returns sql.ErrNoRows if there is no such schedule.
+func (s *SQLiteStorage) DeleteCrawlSchedule(ctx context.Context, name string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM crawl_schedules WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule %s: %w", name, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateCrawlScheduleRun records when a schedule last fired, the crawl it started and when it fires next
+func (s *SQLiteStorage) UpdateCrawlScheduleRun(ctx context.Context, name string, lastRunAt, nextRunAt time.Time, crawlID string) error {
+	query := `UPDATE crawl_schedules SET last_run_at = ?, next_run_at = ?, last_crawl_id = ? WHERE name = ?`
+	_, err := s.db.ExecContext(ctx, query, nullTime(lastRunAt), nullTime(nextRunAt), crawlID, name)
+	if err != nil {
+		return fmt.Errorf("failed to update run of schedule %s: %w", name, err)
+	}
+	return nil
+}
+
+// UpdateCrawlScheduleNextRun records when a schedule fires next, leaving its last run as it is
+func (s *SQLiteStorage) UpdateCrawlScheduleNextRun(ctx context.Context, name string, nextRunAt time.Time) error {
+	query := `UPDATE crawl_schedules SET next_run_at = ? WHERE name = ?`
+	_, err := s.db.ExecContext(ctx, query, nullTime(nextRunAt), name)
+	if err != nil {
+		return fmt.Errorf("failed to update next run of schedule %s: %w", name, err)
+	}
+	return nil
+}
+
+// scanCrawlSchedule reads a crawl_schedules row selected with the columns of GetCrawlSchedules
+func scanCrawlSchedule(row rowScanner) (CrawlSchedule, error) {
+	var schedule CrawlSchedule
+	var seeds string
+	var lastRunAt, nextRunAt sql.NullTime
+	err := row.Scan(&schedule.Name, &schedule.Cron, &seeds, &schedule.Options, &schedule.Enabled, &schedule.Source,
+		&schedule.CreatedAt, &lastRunAt, &nextRunAt, &schedule.LastCrawlID)
+	if err != nil {
+		return schedule, fmt.Errorf("failed to scan row: %w", err)
+	}
+	if err := json.Unmarshal([]byte(seeds), &schedule.Seeds); err != nil {
+		return schedule, fmt.Errorf("failed to decode seeds of schedule %s: %w", schedule.Name, err)
+	}
+	schedule.LastRunAt = lastRunAt.Time
+	schedule.NextRunAt = nextRunAt.Time
+	return schedule, nil
+}
+
+// crawlJobColumns are the columns scanCrawlJob reads, in order
+const crawlJobColumns = `id, seeds, COALESCE(options, ''), status, queued, in_flight, succeeded, failed, skipped,
+	started_at, finished_at`
+
+// SaveCrawlJob creates or replaces a crawl job
+func (s *SQLiteStorage) SaveCrawlJob(ctx context.Context, job CrawlJob) error {
+	seeds, err := json.Marshal(job.Seeds)
+	if err != nil {
+		return fmt.Errorf("failed to encode seeds of job %s: %w", job.ID, err)
+	}
+
+	query := `
+	INSERT INTO crawl_jobs (id, seeds, options, status, queued, in_flight, succeeded, failed, skipped, started_at, finished_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(id) DO UPDATE SET
+		seeds = excluded.seeds,
+		options = excluded.options,
+		status = excluded.status,
+		queued = excluded.queued,
+		in_flight = excluded.in_flight,
+		succeeded = excluded.succeeded,
+		failed = excluded.failed,
+		skipped = excluded.skipped,
+		finished_at = excluded.finished_at;
+	`
+	_, err = s.db.ExecContext(ctx, query, job.ID, string(seeds), job.Options, job.Status, job.Queued, job.InFlight,
+		job.Succeeded, job.Failed, job.Skipped, job.StartedAt.UTC(), nullTime(job.FinishedAt.UTC()))
+	if err != nil {
+		return fmt.Errorf("failed to save job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// GetCrawlJob retrieves a crawl job by ID.
+// Returns sql.ErrNoRows if there is no such job.
+func (s *SQLiteStorage) GetCrawlJob(ctx context.Context, id string) (CrawlJob, error) {
+	query := `SELECT ` + crawlJobColumns + ` FROM crawl_jobs WHERE id = ?`
+	job, err := scanCrawlJob(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return CrawlJob{}, sql.ErrNoRows
+		}
+		return CrawlJob{}, fmt.Errorf("failed to get job %s: %w", id, err)
+	}
+	return job, nil
+}
+
+// GetCrawlJobs retrieves crawl jobs, most recently started first, optionally
+// only those with the given status. A limit of 0 or less returns every job.
+func (s *SQLiteStorage) GetCrawlJobs(ctx context.Context, status string, limit int, offset int) ([]CrawlJob, error) {
+	if limit <= 0 {
+		limit = -1 // No limit in SQLite
+	}
+	query := `SELECT ` + crawlJobColumns + ` FROM crawl_jobs WHERE ? = '' OR status = ?
+	ORDER BY started_at DESC LIMIT ? OFFSET ?`
+
+	rows, err := s.db.QueryContext(ctx, query, status, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []CrawlJob
+	for rows.Next() {
+		job, err := scanCrawlJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// GetCrawlJobsCount returns the number of crawl jobs, optionally only those with the given status
+func (s *SQLiteStorage) GetCrawlJobsCount(ctx context.Context, status string) (int, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM crawl_jobs WHERE ? = '' OR status = ?`
+	if err := s.db.QueryRowContext(ctx, query, status, status).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count jobs: %w", err)
+	}
+	return count, nil
+}
+
+// UpdateCrawlJobCounts adds delta to the task counts of a crawl job and returns the
+// updated job. The in-flight change is also counted for the node making it, so the
+// tasks a node had in flight when it stopped can be told apart from other nodes'.
+// Queued and in-flight counts never drop below zero.
+// Returns sql.ErrNoRows if there is no such job.
+func (s *SQLiteStorage) UpdateCrawlJobCounts(ctx context.Context, id, node string, delta CrawlJobCounts) (CrawlJob, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return CrawlJob{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE crawl_jobs SET
+		queued = MAX(queued + ?, 0),
+		in_flight = MAX(in_flight + ?, 0),
+		succeeded = succeeded + ?,
+		failed = failed + ?,
+		skipped = skipped + ?
+	WHERE id = ?
+	RETURNING ` + crawlJobColumns
+	job, err := scanCrawlJob(tx.QueryRowContext(ctx, query, delta.Queued, delta.InFlight, delta.Succeeded,
+		delta.Failed, delta.Skipped, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return CrawlJob{}, sql.ErrNoRows
+		}
+		return CrawlJob{}, fmt.Errorf("failed to update counts of job %s: %w", id, err)
+	}
+
+	if delta.InFlight != 0 {
+		_, err := tx.ExecContext(ctx, `
+		INSERT INTO crawl_job_nodes (job_id, node, in_flight) VALUES (?, ?, MAX(?, 0))
+		ON CONFLICT (job_id, node) DO UPDATE SET in_flight = MAX(in_flight + ?, 0)`,
+			id, node, delta.InFlight, delta.InFlight)
+		if err != nil {
+			return CrawlJob{}, fmt.Errorf("failed to update in-flight count of job %s on %s: %w", id, node, err)
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM crawl_job_nodes WHERE job_id = ? AND node = ? AND in_flight = 0`, id, node)
+		if err != nil {
+			return CrawlJob{}, fmt.Errorf("failed to update in-flight count of job %s on %s: %w", id, node, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return CrawlJob{}, fmt.Errorf("failed to update counts of job %s: %w", id, err)
+	}
+	return job, nil
+}
+
+// GetCrawlJobsInFlight returns how many tasks of each crawl job a node has in flight
+func (s *SQLiteStorage) GetCrawlJobsInFlight(ctx context.Context, node string) (map[string]int, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT job_id, in_flight FROM crawl_job_nodes WHERE node = ?`, node)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query in-flight tasks of %s: %w", node, err)
+	}
+	defer rows.Close()
+
+	inFlight := make(map[string]int)
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		inFlight[id] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+	return inFlight, nil
+}
+
+// UpdateCrawlJobStatus sets the status of a crawl job and when it finished (zero
+// while it hasn't). When from is given, the job is only updated if its current
+// status is one of them. It reports whether the job was updated.
+func (s *SQLiteStorage) UpdateCrawlJobStatus(ctx context.Context, id string, status string, finishedAt time.Time, from ...string) (bool, error) {
+	query := `UPDATE crawl_jobs SET status = ?, finished_at = ? WHERE id = ?`
+	args := []interface{}{status, nullTime(finishedAt.UTC()), id}
+	if len(from) > 0 {
+		query += ` AND status IN (?` + strings.Repeat(`, ?`, len(from)-1) + `)`
+		for _, f := range from {
+			args = append(args, f)
+		}
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to update status of job %s: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update status of job %s: %w", id, err)
+	}
+	return n > 0, nil
+}
+
+// ParkCrawlJobTasks keeps encoded tasks of a paused crawl job until it is resumed
+func (s *SQLiteStorage) ParkCrawlJobTasks(ctx context.Context, id string, tasks []string) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO crawl_job_tasks (job_id, task) VALUES (?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, task := range tasks {
+		if _, err := stmt.ExecContext(ctx, id, task); err != nil {
+			return fmt.Errorf("failed to park task of job %s: %w", id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to park tasks of job %s: %w", id, err)
+	}
+	return nil
+}
+
+// TakeCrawlJobTasks removes and returns the parked tasks of a crawl job in the order they were parked
+func (s *SQLiteStorage) TakeCrawlJobTasks(ctx context.Context, id string) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT task FROM crawl_job_tasks WHERE job_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query parked tasks of job %s: %w", id, err)
+	}
+	var tasks []string
+	for rows.Next() {
+		var task string
+		if err := rows.Scan(&task); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM crawl_job_tasks WHERE job_id = ?`, id); err != nil {
+		return nil, fmt.Errorf("failed to remove parked tasks of job %s: %w", id, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to take parked tasks of job %s: %w", id, err)
+	}
+	return tasks, nil
+}
+
+// GetSetting retrieves the value stored under a settings key.
+// Returns sql.ErrNoRows if nothing is stored under the key.
+func (s *SQLiteStorage) GetSetting(ctx context.Context, key string) (string, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx, `SELECT value FROM settings WHERE key = ?`, key).Scan(&value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", sql.ErrNoRows
+		}
+		return "", fmt.Errorf("failed to get setting %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// SaveSetting stores a value under a settings key, replacing the previous one
+func (s *SQLiteStorage) SaveSetting(ctx context.Context, key string, value string) error {
+	query := `INSERT INTO settings (key, value, updated_at) VALUES (?, ?, ?)
+	ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`
+	if _, err := s.db.ExecContext(ctx, query, key, value, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to save setting %s: %w", key, err)
+	}
+	return nil
+}
+
+// scanCrawlJob reads a crawl_jobs row selected with crawlJobColumns
+func scanCrawlJob(row rowScanner) (CrawlJob, error) {
+	var job CrawlJob
+	var seeds string
+	var finishedAt sql.NullTime
+	err := row.Scan(&job.ID, &seeds, &job.Options, &job.Status, &job.Queued, &job.InFlight, &job.Succeeded,
+		&job.Failed, &job.Skipped, &job.StartedAt, &finishedAt)
+	if err != nil {
+		return job, fmt.Errorf("failed to scan row: %w", err)
+	}
+	if err := json.Unmarshal([]byte(seeds), &job.Seeds); err != nil {
+		return job, fmt.Errorf("failed to decode seeds of job %s: %w", job.ID, err)
+	}
+	job.FinishedAt = finishedAt.Time
+	return job, nil
+}
+
+// nullTime stores the zero time as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
 // Close closes the database connection
 func (s *SQLiteStorage) Close() error {
 	if s.db != nil {
@@ -8,28 +8,33 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/MunishMummadi/web-scrapper/api"
+	"github.com/MunishMummadi/web-scrapper/blobstore"
 	"github.com/MunishMummadi/web-scrapper/config"
 	"github.com/MunishMummadi/web-scrapper/crawler"
 	"github.com/MunishMummadi/web-scrapper/database"
 	"github.com/MunishMummadi/web-scrapper/metrics"
 	"github.com/MunishMummadi/web-scrapper/proxy"
 	"github.com/MunishMummadi/web-scrapper/queue"
+	"github.com/MunishMummadi/web-scrapper/scheduler"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var (
 	configFile  string
 	seedURL     string
+	sitemapURL  string
 	useMemQueue bool
 )
 
 func init() {
 	flag.StringVar(&configFile, "config", "", "Path to configuration file")
 	flag.StringVar(&seedURL, "seed", "", "Seed URL to start crawling")
+	flag.StringVar(&sitemapURL, "sitemap", "", "Sitemap or sitemap index URL to crawl the pages of")
 	flag.BoolVar(&useMemQueue, "mem-queue", false, "Use in-memory queue instead of Redis (useful for testing)")
 }
 
@@ -51,11 +56,20 @@ func main() {
 	log.Println("Initializing metrics collector...")
 	metricsCollector := metrics.NewMetricsCollector()
 
-	// Initialize queue (Redis-based or in-memory)
+	// Initialize queue, dead-letter queue, seen-set, schedule lock and robots.txt store (Redis-based or in-memory)
 	var q queue.Queue
+	var dlq queue.DeadLetterQueue
+	var seen queue.SeenSet
+	var scheduleLock scheduler.Lock
+	var robotsStore crawler.RobotsStore
+	durableQueue := false // Whether queued tasks survive a restart
 	if useMemQueue {
 		log.Println("Using in-memory queue (as requested)...")
 		q = queue.NewMemoryQueue()
+		dlq = queue.NewMemoryDeadLetterQueue()
+		seen = queue.NewMemorySeenSet(cfg.Crawler.SeenExpiration)
+		scheduleLock = scheduler.NewMemoryLock()
+		robotsStore = crawler.NewMemoryRobotsStore()
 	} else {
 		log.Println("Initializing Redis queue...")
 		redisQueue, err := queue.NewRedisQueue(cfg.Redis)
@@ -63,11 +77,36 @@ func main() {
 			log.Printf("Failed to initialize Redis queue: %v", err)
 			log.Println("Falling back to in-memory queue...")
 			q = queue.NewMemoryQueue()
+			dlq = queue.NewMemoryDeadLetterQueue()
+			seen = queue.NewMemorySeenSet(cfg.Crawler.SeenExpiration)
+			scheduleLock = scheduler.NewMemoryLock()
+			robotsStore = crawler.NewMemoryRobotsStore()
 		} else {
 			q = redisQueue
+			durableQueue = true
+			dlq, err = queue.NewRedisDeadLetterQueue(cfg.Redis)
+			if err != nil {
+				log.Fatalf("Failed to initialize Redis dead-letter queue: %v", err)
+			}
+			seen, err = queue.NewRedisSeenSet(cfg.Redis, cfg.Crawler.SeenExpiration)
+			if err != nil {
+				log.Fatalf("Failed to initialize Redis seen-set: %v", err)
+			}
+			scheduleLock, err = scheduler.NewRedisLock(cfg.Redis)
+			if err != nil {
+				log.Fatalf("Failed to initialize Redis schedule lock: %v", err)
+			}
+			robotsStore, err = crawler.NewRedisRobotsStore(cfg.Redis)
+			if err != nil {
+				log.Fatalf("Failed to initialize Redis robots.txt store: %v", err)
+			}
 		}
 	}
 	defer q.Close()
+	defer dlq.Close()
+	defer seen.Close()
+	defer scheduleLock.Close()
+	defer robotsStore.Close()
 
 	// Initialize SQLite storage
 	log.Println("Initializing SQLite storage...")
@@ -77,6 +116,16 @@ func main() {
 	}
 	defer sqliteStorage.Close()
 
+	// Initialize blob store for response bodies
+	log.Printf("Initializing blob store (%s)...", cfg.BlobStore.Backend)
+	blobs, err := blobstore.New(cfg.BlobStore)
+	if err != nil {
+		log.Fatalf("Failed to initialize blob store: %v", err)
+	}
+	if blobs != nil {
+		defer blobs.Close()
+	}
+
 	// Initialize proxy manager
 	log.Println("Initializing proxy manager...")
 	proxyManager, err := proxy.NewManager(cfg.Proxies)
@@ -87,11 +136,21 @@ func main() {
 
 	// Initialize crawler
 	log.Println("Initializing crawler...")
-	c, err := crawler.NewCrawler(cfg, q, sqliteStorage, metricsCollector, proxyManager)
+	c, err := crawler.NewCrawler(cfg, q, dlq, seen, robotsStore, sqliteStorage, blobs, metricsCollector, proxyManager)
 	if err != nil {
 		log.Fatalf("Failed to initialize crawler: %v", err)
 	}
 
+	// Apply settings changed through the API in an earlier run
+	if err := c.LoadSettings(ctx); err != nil {
+		log.Fatalf("Failed to load crawler settings: %v", err)
+	}
+
+	// Reconcile jobs left unfinished by the previous run
+	if err := c.RecoverJobs(ctx, durableQueue); err != nil {
+		log.Fatalf("Failed to recover crawl jobs: %v", err)
+	}
+
 	// Start crawler
 	log.Println("Starting crawler...")
 	c.Start(ctx)
@@ -100,13 +159,34 @@ func main() {
 	// If seed URL is provided, enqueue it
 	if seedURL != "" {
 		log.Printf("Enqueuing seed URL: %s", seedURL)
-		if err := c.EnqueueURL(ctx, seedURL); err != nil {
+		crawlID, err := c.StartCrawl(ctx, []string{seedURL}, crawler.DefaultCrawlOptions(&cfg.Crawler))
+		if err != nil {
 			log.Printf("Failed to enqueue seed URL: %v", err)
+		} else {
+			log.Printf("Started crawl %s from seed URL", crawlID)
+		}
+	}
+	if sitemapURL != "" {
+		log.Printf("Enqueuing sitemap: %s", sitemapURL)
+		crawlID, err := c.StartSitemapCrawl(ctx, []string{sitemapURL}, crawler.DefaultCrawlOptions(&cfg.Crawler))
+		if err != nil {
+			log.Printf("Failed to enqueue sitemap: %v", err)
+		} else {
+			log.Printf("Started crawl %s from sitemap", crawlID)
 		}
 	}
 
+	// Start firing scheduled crawls
+	log.Println("Starting crawl scheduler...")
+	crawlScheduler := scheduler.NewScheduler(sqliteStorage, c, scheduleLock, metricsCollector, &cfg.Crawler)
+	if err := crawlScheduler.Load(ctx, cfg.Schedules); err != nil {
+		log.Fatalf("Failed to load crawl schedules: %v", err)
+	}
+	crawlScheduler.Start(ctx)
+	defer crawlScheduler.Stop()
+
 	// Set up HTTP server for API and metrics
-	apiServer := setupAPIServer(cfg, c, metricsCollector, sqliteStorage)
+	apiServer := setupAPIServer(cfg, c, metricsCollector, sqliteStorage, blobs, dlq, crawlScheduler)
 
 	// Start HTTP server in a goroutine
 	go func() {
@@ -135,7 +215,7 @@ func main() {
 	log.Println("All services stopped, exiting")
 }
 
-func setupAPIServer(cfg *config.Config, c *crawler.Crawler, m *metrics.MetricsCollector, storage database.Storage) *http.Server {
+func setupAPIServer(cfg *config.Config, c *crawler.Crawler, m *metrics.MetricsCollector, storage database.Storage, blobs blobstore.Store, dlq queue.DeadLetterQueue, s *scheduler.Scheduler) *http.Server {
 	mux := http.NewServeMux()
 
 	// API endpoint for submitting URLs
@@ -151,18 +231,65 @@ func setupAPIServer(cfg *config.Config, c *crawler.Crawler, m *metrics.MetricsCo
 			return
 		}
 
+		// Crawl options default to the config and can be overridden per request
+		opts, err := parseCrawlOptions(r, crawler.DefaultCrawlOptions(&cfg.Crawler))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 		defer cancel()
 
-		// Enqueue the URL for crawling
-		err := c.EnqueueURL(ctx, urlToScrape)
+		// Start a crawl seeded with the URL
+		crawlID, err := c.StartCrawl(ctx, []string{urlToScrape}, opts)
 		if err != nil {
+			if crawlID == "" {
+				http.Error(w, fmt.Sprintf("Invalid crawl request: %v", err), http.StatusBadRequest)
+				return
+			}
 			http.Error(w, fmt.Sprintf("Failed to enqueue URL: %v", err), http.StatusInternalServerError)
 			return
 		}
 
 		w.WriteHeader(http.StatusAccepted)
-		fmt.Fprintf(w, "URL %s has been queued for crawling\n", urlToScrape)
+		fmt.Fprintf(w, "URL %s has been queued for crawling (crawl %s)\n", urlToScrape, crawlID)
+	})
+
+	// API endpoint for submitting sitemaps and sitemap indexes
+	mux.HandleFunc("/api/sitemaps", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		opts, err := parseCrawlOptions(r, crawler.DefaultCrawlOptions(&cfg.Crawler))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sitemaps := r.Form["url"]
+		if len(sitemaps) == 0 {
+			http.Error(w, "URL parameter is required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		// Workers fetch and expand the sitemaps, so large ones don't hold up the request
+		crawlID, err := c.StartSitemapCrawl(ctx, sitemaps, opts)
+		if err != nil {
+			if crawlID == "" {
+				http.Error(w, fmt.Sprintf("Invalid crawl request: %v", err), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to enqueue sitemap: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "%d sitemap(s) queued for crawling (crawl %s)\n", len(sitemaps), crawlID)
 	})
 
 	// API endpoint for health check
@@ -172,9 +299,25 @@ func setupAPIServer(cfg *config.Config, c *crawler.Crawler, m *metrics.MetricsCo
 	})
 
 	// Data view handler for viewing scraped pages
-	dataViewHandler := api.NewDataViewHandler(storage)
+	dataViewHandler := api.NewDataViewHandler(storage, c)
 	dataViewHandler.RegisterRoutes(mux)
 
+	// Page handler for stored response bodies
+	pageHandler := api.NewPageHandler(storage, blobs)
+	pageHandler.RegisterRoutes(mux)
+
+	// Dead-letter handler for triaging and replaying failed URLs
+	deadLetterHandler := api.NewDeadLetterHandler(dlq, c.EnqueueTask)
+	deadLetterHandler.RegisterRoutes(mux)
+
+	// Job handler for reporting and controlling crawl jobs
+	jobHandler := api.NewJobHandler(storage, c)
+	jobHandler.RegisterRoutes(mux)
+
+	// Schedule handler for cron-scheduled crawls
+	scheduleHandler := api.NewScheduleHandler(s)
+	scheduleHandler.RegisterRoutes(mux)
+
 	// Prometheus metrics endpoint
 	mux.Handle("/metrics", promhttp.Handler())
 
@@ -184,4 +327,61 @@ func setupAPIServer(cfg *config.Config, c *crawler.Crawler, m *metrics.MetricsCo
 		ReadTimeout:  cfg.API.ReadTimeout,
 		WriteTimeout: cfg.API.WriteTimeout,
 	}
+}
+
+// parseCrawlOptions applies the crawl overrides present in an enqueue request to the defaults.
+// Recognised form fields: max_depth, max_pages, max_pages_per_host, priority,
+// link_priority, scope and the repeatable include, exclude and path_prefix.
+func parseCrawlOptions(r *http.Request, opts crawler.CrawlOptions) (crawler.CrawlOptions, error) {
+	if err := r.ParseForm(); err != nil {
+		return opts, fmt.Errorf("invalid form: %w", err)
+	}
+
+	intFields := map[string]*int{
+		"max_depth":          &opts.MaxDepth,
+		"max_pages":          &opts.MaxPages,
+		"max_pages_per_host": &opts.MaxPagesPerHost,
+	}
+	for name, target := range intFields {
+		value := r.Form.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("%s must be a non-negative integer", name)
+		}
+		*target = n
+	}
+
+	priorityFields := map[string]*queue.Priority{
+		"priority":      &opts.Priority,
+		"link_priority": &opts.LinkPriority,
+	}
+	for name, target := range priorityFields {
+		value := r.Form.Get(name)
+		if value == "" {
+			continue
+		}
+		p, err := queue.ParsePriority(value)
+		if err != nil {
+			return opts, fmt.Errorf("%s: %v", name, err)
+		}
+		*target = p
+	}
+
+	if scope := r.Form.Get("scope"); scope != "" {
+		opts.Scope.Mode = scope
+	}
+	if include, ok := r.Form["include"]; ok {
+		opts.Scope.Include = include
+	}
+	if exclude, ok := r.Form["exclude"]; ok {
+		opts.Scope.Exclude = exclude
+	}
+	if prefixes, ok := r.Form["path_prefix"]; ok {
+		opts.Scope.PathPrefixes = prefixes
+	}
+
+	return opts, nil
 }
\ No newline at end of file
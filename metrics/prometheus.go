@@ -13,11 +13,20 @@ import (
 type MetricsCollector struct {
 	// Counters
 	ScrapedPagesTotal      prometheus.Counter
-	ScrapingErrorsTotal    prometheus.Counter
+	ScrapingErrorsTotal    *prometheus.CounterVec
 	QueuedURLsTotal        prometheus.Counter
 	RobotsDisallowedTotal  prometheus.Counter
+	RobotsSuppressedTotal  *prometheus.CounterVec
 	CircuitBreakerTripsTotal prometheus.Counter
 	ProxyFailuresTotal     prometheus.Counter
+	FrontierDecisionsTotal *prometheus.CounterVec
+	DeadLettersTotal       prometheus.Counter
+	RetriesTotal           prometheus.Counter
+	PageChangesTotal       prometheus.Counter
+	NotModifiedTotal       prometheus.Counter
+	RecrawlsTotal          prometheus.Counter
+	ScheduledRunsTotal     *prometheus.CounterVec
+	ThrottledResponsesTotal prometheus.Counter
 
 	// Gauges
 	WorkersRunning         prometheus.Gauge
@@ -42,10 +51,10 @@ func NewMetricsCollector() *MetricsCollector {
 			Name: "scraper_pages_scraped_total",
 			Help: "The total number of pages scraped",
 		}),
-		ScrapingErrorsTotal: promauto.NewCounter(prometheus.CounterOpts{
+		ScrapingErrorsTotal: promauto.NewCounterVec(prometheus.CounterOpts{
 			Name: "scraper_errors_total",
-			Help: "The total number of scraping errors",
-		}),
+			Help: "The total number of URLs that failed for good, by error class",
+		}, []string{"class"}),
 		QueuedURLsTotal: promauto.NewCounter(prometheus.CounterOpts{
 			Name: "scraper_urls_queued_total",
 			Help: "The total number of URLs queued",
@@ -54,6 +63,10 @@ func NewMetricsCollector() *MetricsCollector {
 			Name: "scraper_robots_disallowed_total",
 			Help: "The total number of URLs disallowed by robots.txt",
 		}),
+		RobotsSuppressedTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "scraper_robots_suppressed_total",
+			Help: "The total number of pages not stored (noindex) or links not followed (nofollow), by directive and source (meta, header, link)",
+		}, []string{"directive", "source"}),
 		CircuitBreakerTripsTotal: promauto.NewCounter(prometheus.CounterOpts{
 			Name: "scraper_circuit_breaker_trips_total",
 			Help: "The total number of circuit breaker trips",
@@ -62,6 +75,38 @@ func NewMetricsCollector() *MetricsCollector {
 			Name: "scraper_proxy_failures_total",
 			Help: "The total number of proxy failures",
 		}),
+		FrontierDecisionsTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "scraper_frontier_decisions_total",
+			Help: "The total number of frontier decisions for discovered URLs",
+		}, []string{"decision", "reason"}),
+		DeadLettersTotal: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "scraper_dead_letters_total",
+			Help: "The total number of tasks moved to the dead-letter queue",
+		}),
+		RetriesTotal: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "scraper_retries_scheduled_total",
+			Help: "The total number of delayed retries scheduled",
+		}),
+		PageChangesTotal: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "scraper_page_changes_total",
+			Help: "The total number of fetches whose content differed from the previous version",
+		}),
+		NotModifiedTotal: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "scraper_not_modified_total",
+			Help: "The total number of conditional recrawls answered with 304 Not Modified",
+		}),
+		RecrawlsTotal: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "scraper_recrawls_total",
+			Help: "The total number of pages enqueued by the recrawl scheduler",
+		}),
+		ScheduledRunsTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "scraper_scheduled_runs_total",
+			Help: "The total number of times a crawl schedule came due, by outcome",
+		}, []string{"schedule", "outcome"}),
+		ThrottledResponsesTotal: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "scraper_throttled_responses_total",
+			Help: "The total number of 429 and 503 responses asking the crawler to slow down",
+		}),
 
 		// Gauges
 		WorkersRunning: promauto.NewGauge(prometheus.GaugeOpts{
@@ -132,9 +177,9 @@ func (m *MetricsCollector) IncrementScrapedPages() {
 	m.ScrapedPagesTotal.Inc()
 }
 
-// IncrementScrapingErrors increments the counter for scraping errors
-func (m *MetricsCollector) IncrementScrapingErrors() {
-	m.ScrapingErrorsTotal.Inc()
+// IncrementScrapingErrors increments the counter for scraping errors of an error class
+func (m *MetricsCollector) IncrementScrapingErrors(class string) {
+	m.ScrapingErrorsTotal.WithLabelValues(class).Inc()
 }
 
 // IncrementQueuedURLs increments the counter for queued URLs
@@ -147,6 +192,11 @@ func (m *MetricsCollector) IncrementRobotsDisallowed() {
 	m.RobotsDisallowedTotal.Inc()
 }
 
+// IncrementRobotsSuppressed counts a page or link suppressed by a noindex or nofollow directive
+func (m *MetricsCollector) IncrementRobotsSuppressed(directive, source string) {
+	m.RobotsSuppressedTotal.WithLabelValues(directive, source).Inc()
+}
+
 // IncrementCircuitBreakerTrips increments the counter for circuit breaker trips
 func (m *MetricsCollector) IncrementCircuitBreakerTrips() {
 	m.CircuitBreakerTripsTotal.Inc()
@@ -157,6 +207,46 @@ func (m *MetricsCollector) IncrementProxyFailures() {
 	m.ProxyFailuresTotal.Inc()
 }
 
+// RecordFrontierDecision counts a decision to enqueue or drop a URL
+func (m *MetricsCollector) RecordFrontierDecision(decision, reason string) {
+	m.FrontierDecisionsTotal.WithLabelValues(decision, reason).Inc()
+}
+
+// IncrementDeadLetters increments the counter for dead-lettered tasks
+func (m *MetricsCollector) IncrementDeadLetters() {
+	m.DeadLettersTotal.Inc()
+}
+
+// IncrementRetries increments the counter for scheduled retries
+func (m *MetricsCollector) IncrementRetries() {
+	m.RetriesTotal.Inc()
+}
+
+// IncrementPageChanges increments the counter for pages whose content changed
+func (m *MetricsCollector) IncrementPageChanges() {
+	m.PageChangesTotal.Inc()
+}
+
+// IncrementNotModified increments the counter for 304 Not Modified responses
+func (m *MetricsCollector) IncrementNotModified() {
+	m.NotModifiedTotal.Inc()
+}
+
+// IncrementRecrawls increments the counter for pages enqueued for a recrawl
+func (m *MetricsCollector) IncrementRecrawls() {
+	m.RecrawlsTotal.Inc()
+}
+
+// RecordScheduledRun increments the counter for a crawl schedule coming due
+func (m *MetricsCollector) RecordScheduledRun(schedule, outcome string) {
+	m.ScheduledRunsTotal.WithLabelValues(schedule, outcome).Inc()
+}
+
+// IncrementThrottledResponses increments the counter for 429 and 503 responses
+func (m *MetricsCollector) IncrementThrottledResponses() {
+	m.ThrottledResponsesTotal.Inc()
+}
+
 // SetWorkersRunning sets the gauge for running workers
 func (m *MetricsCollector) SetWorkersRunning(count int) {
 	m.WorkersRunning.Set(float64(count))
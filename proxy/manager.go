@@ -225,6 +225,24 @@ func (m *Manager) RecordFailure(proxyURL string) {
 	}
 }
 
+// Counts returns the number of healthy proxies and the total number of proxies
+func (m *Manager) Counts() (int, int) {
+	if !m.enabled {
+		return 0, 0
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	healthy := 0
+	for _, proxy := range m.proxies {
+		if proxy.Healthy {
+			healthy++
+		}
+	}
+	return healthy, len(m.proxies)
+}
+
 // Close stops the refresh timer
 func (m *Manager) Close() {
 	if m.refreshTimer != nil {
@@ -0,0 +1,336 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/config"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultDeadLetterKey  = "scraper:deadletter"
+	deadLetterIndexSuffix = ":index" // Sorted set of entry ID scored by failure time (unix ms)
+)
+
+// DeadLetter is a task that permanently failed, with the details of its last failure
+type DeadLetter struct {
+	ID         string    `json:"id"`
+	Task       *Task     `json:"task"`
+	LastError  string    `json:"last_error"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Attempts   int       `json:"attempts"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	FailedAt   time.Time `json:"failed_at"`
+}
+
+// NewDeadLetter creates a dead-letter entry for a task that failed with err
+func NewDeadLetter(task *Task, err error, statusCode int) *DeadLetter {
+	entry := &DeadLetter{
+		ID:         newID(),
+		Task:       task,
+		StatusCode: statusCode,
+		Attempts:   task.Attempt,
+		EnqueuedAt: task.EnqueuedAt,
+		FailedAt:   time.Now(),
+	}
+	if err != nil {
+		entry.LastError = err.Error()
+	}
+	return entry
+}
+
+// DeadLetterQueue stores permanently failed tasks for inspection and replay.
+// List returns the most recently failed entries first. Take removes and
+// returns entries by ID, or the oldest limit entries when ids is empty. Purge
+// deletes entries by ID, or every entry when ids is empty.
+type DeadLetterQueue interface {
+	Add(ctx context.Context, entry *DeadLetter) error
+	List(ctx context.Context, offset, limit int) ([]*DeadLetter, error)
+	Count(ctx context.Context) (int, error)
+	Take(ctx context.Context, ids []string, limit int) ([]*DeadLetter, error)
+	Purge(ctx context.Context, ids []string) (int, error)
+	Close() error
+}
+
+// takeScript removes the given dead-letter entries and returns their payloads
+var takeScript = redis.NewScript(`
+local taken = {}
+for _, id in ipairs(ARGV) do
+	local payload = redis.call('HGET', KEYS[1], id)
+	if payload then
+		redis.call('HDEL', KEYS[1], id)
+		table.insert(taken, payload)
+	end
+	redis.call('ZREM', KEYS[2], id)
+end
+return taken
+`)
+
+// RedisDeadLetterQueue implements DeadLetterQueue with a Redis hash of
+// entries and a sorted set indexing them by failure time
+type RedisDeadLetterQueue struct {
+	client   *redis.Client
+	key      string
+	indexKey string
+}
+
+// NewRedisDeadLetterQueue creates a new Redis-based dead-letter queue
+func NewRedisDeadLetterQueue(cfg config.RedisConfig) (DeadLetterQueue, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address(),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	// Ping Redis to ensure connection is established
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+
+	return &RedisDeadLetterQueue{
+		client:   client,
+		key:      defaultDeadLetterKey,
+		indexKey: defaultDeadLetterKey + deadLetterIndexSuffix,
+	}, nil
+}
+
+// Add stores a failed task
+func (q *RedisDeadLetterQueue) Add(ctx context.Context, entry *DeadLetter) error {
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode dead letter for %s: %w", entry.Task.URL, err)
+	}
+	_, err = q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, q.key, entry.ID, payload)
+		pipe.ZAdd(ctx, q.indexKey, &redis.Z{Score: float64(entry.FailedAt.UnixMilli()), Member: entry.ID})
+		return nil
+	})
+	return err
+}
+
+// List returns a page of entries, most recent failure first
+func (q *RedisDeadLetterQueue) List(ctx context.Context, offset, limit int) ([]*DeadLetter, error) {
+	ids, err := q.client.ZRevRange(ctx, q.indexKey, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*DeadLetter{}, nil
+	}
+
+	payloads, err := q.client.HMGet(ctx, q.key, ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*DeadLetter, 0, len(payloads))
+	for _, payload := range payloads {
+		str, ok := payload.(string)
+		if !ok {
+			continue // Taken or purged since the index was read
+		}
+		entry, err := decodeDeadLetter(str)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Count returns the number of stored entries
+func (q *RedisDeadLetterQueue) Count(ctx context.Context) (int, error) {
+	n, err := q.client.ZCard(ctx, q.indexKey).Result()
+	return int(n), err
+}
+
+// Take removes and returns entries by ID, or the oldest limit entries when ids is empty
+func (q *RedisDeadLetterQueue) Take(ctx context.Context, ids []string, limit int) ([]*DeadLetter, error) {
+	if len(ids) == 0 {
+		if limit <= 0 {
+			return []*DeadLetter{}, nil
+		}
+		var err error
+		ids, err = q.client.ZRange(ctx, q.indexKey, 0, int64(limit-1)).Result()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(ids) == 0 {
+		return []*DeadLetter{}, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	payloads, err := takeScript.Run(ctx, q.client, []string{q.key, q.indexKey}, args...).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*DeadLetter, 0, len(payloads))
+	for _, payload := range payloads {
+		entry, err := decodeDeadLetter(payload)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Purge deletes entries by ID, or every entry when ids is empty
+func (q *RedisDeadLetterQueue) Purge(ctx context.Context, ids []string) (int, error) {
+	if len(ids) == 0 {
+		n, err := q.client.ZCard(ctx, q.indexKey).Result()
+		if err != nil {
+			return 0, err
+		}
+		if err := q.client.Del(ctx, q.key, q.indexKey).Err(); err != nil {
+			return 0, err
+		}
+		return int(n), nil
+	}
+
+	var removed *redis.IntCmd
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		removed = pipe.HDel(ctx, q.key, ids...)
+		members := make([]interface{}, len(ids))
+		for i, id := range ids {
+			members[i] = id
+		}
+		pipe.ZRem(ctx, q.indexKey, members...)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(removed.Val()), nil
+}
+
+// Close closes the Redis client connection
+func (q *RedisDeadLetterQueue) Close() error {
+	return q.client.Close()
+}
+
+// decodeDeadLetter deserializes a stored dead-letter entry
+func decodeDeadLetter(payload string) (*DeadLetter, error) {
+	var entry DeadLetter
+	if err := json.Unmarshal([]byte(payload), &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode dead letter: %w", err)
+	}
+	return &entry, nil
+}
+
+// MemoryDeadLetterQueue implements DeadLetterQueue in memory
+// This is primarily for testing purposes or when Redis is not available
+type MemoryDeadLetterQueue struct {
+	entries []*DeadLetter // Ordered by failure time, oldest first
+	mu      sync.Mutex
+}
+
+// NewMemoryDeadLetterQueue creates a new in-memory dead-letter queue
+func NewMemoryDeadLetterQueue() DeadLetterQueue {
+	return &MemoryDeadLetterQueue{}
+}
+
+// Add stores a failed task
+func (q *MemoryDeadLetterQueue) Add(ctx context.Context, entry *DeadLetter) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.entries = append(q.entries, entry)
+	sort.SliceStable(q.entries, func(i, j int) bool {
+		return q.entries[i].FailedAt.Before(q.entries[j].FailedAt)
+	})
+	return nil
+}
+
+// List returns a page of entries, most recent failure first
+func (q *MemoryDeadLetterQueue) List(ctx context.Context, offset, limit int) ([]*DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries := make([]*DeadLetter, 0, limit)
+	for i := len(q.entries) - 1 - offset; i >= 0 && len(entries) < limit; i-- {
+		entries = append(entries, q.entries[i])
+	}
+	return entries, nil
+}
+
+// Count returns the number of stored entries
+func (q *MemoryDeadLetterQueue) Count(ctx context.Context) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.entries), nil
+}
+
+// Take removes and returns entries by ID, or the oldest limit entries when ids is empty
+func (q *MemoryDeadLetterQueue) Take(ctx context.Context, ids []string, limit int) ([]*DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(ids) == 0 {
+		if limit <= 0 {
+			return []*DeadLetter{}, nil
+		}
+		if limit > len(q.entries) {
+			limit = len(q.entries)
+		}
+		taken := append([]*DeadLetter(nil), q.entries[:limit]...)
+		q.entries = q.entries[limit:]
+		return taken, nil
+	}
+
+	taken, kept := q.split(ids)
+	q.entries = kept
+	return taken, nil
+}
+
+// Purge deletes entries by ID, or every entry when ids is empty
+func (q *MemoryDeadLetterQueue) Purge(ctx context.Context, ids []string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(ids) == 0 {
+		n := len(q.entries)
+		q.entries = nil
+		return n, nil
+	}
+
+	removed, kept := q.split(ids)
+	q.entries = kept
+	return len(removed), nil
+}
+
+// Close is a no-op for the memory dead-letter queue
+func (q *MemoryDeadLetterQueue) Close() error {
+	return nil
+}
+
+// split partitions the entries into those with one of the given IDs and the rest
+func (q *MemoryDeadLetterQueue) split(ids []string) ([]*DeadLetter, []*DeadLetter) {
+	wanted := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		wanted[id] = struct{}{}
+	}
+
+	var matched, rest []*DeadLetter
+	for _, entry := range q.entries {
+		if _, ok := wanted[entry.ID]; ok {
+			matched = append(matched, entry)
+		} else {
+			rest = append(rest, entry)
+		}
+	}
+	return matched, rest
+}
@@ -0,0 +1,35 @@
+package queue
+
+import (
+	"container/heap"
+	"time"
+)
+
+// delayedHeap is a min-heap of tasks ordered by their NotBefore time
+type delayedHeap []*Task
+
+func (h delayedHeap) Len() int           { return len(h) }
+func (h delayedHeap) Less(i, j int) bool { return h[i].NotBefore.Before(h[j].NotBefore) }
+func (h delayedHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *delayedHeap) Push(x interface{}) {
+	*h = append(*h, x.(*Task))
+}
+
+func (h *delayedHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	task := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return task
+}
+
+// popDue removes and returns every task whose NotBefore has passed, earliest first
+func (h *delayedHeap) popDue(now time.Time) []*Task {
+	var due []*Task
+	for h.Len() > 0 && !(*h)[0].NotBefore.After(now) {
+		due = append(due, heap.Pop(h).(*Task))
+	}
+	return due
+}
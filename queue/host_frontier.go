@@ -0,0 +1,441 @@
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxPerHost      = 2           // Tasks buffered locally per host
+	defaultMaxBuffered     = 500         // Tasks buffered locally across all hosts
+	defaultPullsPerDequeue = 10          // Tasks pulled from the inner queue per Dequeue call
+	maxReadyWait           = time.Second // Longest Dequeue waits for a buffered host to become ready
+	leaseHoldShare         = 4           // Tasks are buffered for at most 1/leaseHoldShare of the lease timeout
+)
+
+// HostPacer tells the frontier when each host can next be fetched
+type HostPacer interface {
+	// NextAllowed returns the earliest time a fetch for host would not have to wait
+	NextAllowed(host string) time.Time
+	// Interval returns the minimum spacing between fetches for host
+	Interval(host string) time.Duration
+}
+
+// hostQueue holds the locally buffered tasks of one host
+type hostQueue struct {
+	host      string
+	tasks     []*Task
+	heldSince []time.Time // When each task was buffered
+	readyAt   time.Time   // When the next task of this host may be handed out
+	heapIndex int         // Position in the ready heap, -1 when not in it
+}
+
+// readyHeap orders hosts with buffered tasks by the time they become ready
+type readyHeap []*hostQueue
+
+func (h readyHeap) Len() int           { return len(h) }
+func (h readyHeap) Less(i, j int) bool { return h[i].readyAt.Before(h[j].readyAt) }
+func (h readyHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *readyHeap) Push(x interface{}) {
+	hq := x.(*hostQueue)
+	hq.heapIndex = len(*h)
+	*h = append(*h, hq)
+}
+
+func (h *readyHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	hq := old[n-1]
+	old[n-1] = nil
+	hq.heapIndex = -1
+	*h = old[:n-1]
+	return hq
+}
+
+// HostFrontier is a Queue that partitions work by host so workers only ever
+// receive URLs that can be fetched right now. It wraps another Queue: tasks
+// pulled from it are handed out immediately when their host is ready, buffered
+// in a small per-host sub-queue otherwise, and pushed back to the inner queue
+// as delayed tasks (due when the host is expected to be ready) once that
+// sub-queue is full. A ready-host rotation keyed on each host's next allowed
+// fetch time decides which buffered task goes out next. Buffered tasks stay
+// leased in the inner queue, so a task is only buffered while its host is
+// expected to be ready well within the lease; otherwise it is pushed back too.
+type HostFrontier struct {
+	inner       Queue
+	pacer       HostPacer
+	maxPerHost  int
+	maxBuffered int
+	maxHold     time.Duration // Longest a task may be buffered before its lease is at risk
+
+	mu         sync.Mutex
+	hosts      map[string]*hostQueue
+	ready      readyHeap
+	lastIssued map[string]time.Time // Last hand-out per host, pruned once the host is idle
+	buffered   int
+}
+
+// NewHostFrontier wraps a queue with per-host fair scheduling. leaseTimeout is how
+// long the inner queue leases a dequeued task before redelivering it.
+func NewHostFrontier(inner Queue, pacer HostPacer, leaseTimeout time.Duration) *HostFrontier {
+	if leaseTimeout <= 0 {
+		leaseTimeout = defaultVisibility
+	}
+	return &HostFrontier{
+		inner:       inner,
+		pacer:       pacer,
+		maxPerHost:  defaultMaxPerHost,
+		maxBuffered: defaultMaxBuffered,
+		maxHold:     leaseTimeout / leaseHoldShare,
+		hosts:       make(map[string]*hostQueue),
+		lastIssued:  make(map[string]time.Time),
+	}
+}
+
+// Enqueue adds a task to the inner queue
+func (f *HostFrontier) Enqueue(ctx context.Context, task *Task) error {
+	return f.inner.Enqueue(ctx, task)
+}
+
+// Dequeue returns a task whose host can be fetched now, or nil if there is none
+func (f *HostFrontier) Dequeue(ctx context.Context) (*Task, error) {
+	if task := f.popReady(); task != nil {
+		return task, nil
+	}
+
+	// Nothing buffered is ready, look for fresh work in the inner queue
+	for i := 0; i < defaultPullsPerDequeue; i++ {
+		task, err := f.inner.Dequeue(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if task == nil {
+			break
+		}
+
+		if f.admit(task) {
+			return task, nil
+		}
+
+		// The task was buffered or deferred, maybe a buffered one became ready meanwhile
+		if task := f.popReady(); task != nil {
+			return task, nil
+		}
+	}
+
+	// Everything on hand is for hosts that are still cooling down, wait for the
+	// first of them instead of sending the worker into its empty-queue backoff
+	return f.waitReady(ctx), nil
+}
+
+// waitReady waits until the next buffered host is ready and hands out its task,
+// giving up when ctx is done or the host is more than maxReadyWait away
+func (f *HostFrontier) waitReady(ctx context.Context) *Task {
+	f.mu.Lock()
+	if f.ready.Len() == 0 {
+		f.mu.Unlock()
+		return nil
+	}
+	wait := time.Until(f.ready[0].readyAt)
+	f.mu.Unlock()
+
+	if wait > maxReadyWait {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-timer.C:
+		return f.popReady()
+	}
+}
+
+// Ack acknowledges a task with the inner queue
+func (f *HostFrontier) Ack(ctx context.Context, task *Task) error {
+	return f.inner.Ack(ctx, task)
+}
+
+// Nack hands a task back to the inner queue
+func (f *HostFrontier) Nack(ctx context.Context, task *Task) error {
+	return f.inner.Nack(ctx, task)
+}
+
+// RemoveCrawl removes the tasks of a crawl buffered locally, acknowledging them
+// with the inner queue, and then those still in the inner queue
+func (f *HostFrontier) RemoveCrawl(ctx context.Context, crawlID string) ([]*Task, error) {
+	f.mu.Lock()
+	var removed []*Task
+	for host, hq := range f.hosts {
+		kept, keptSince := hq.tasks[:0], hq.heldSince[:0]
+		for i, task := range hq.tasks {
+			if task.CrawlID == crawlID {
+				removed = append(removed, task)
+			} else {
+				kept = append(kept, task)
+				keptSince = append(keptSince, hq.heldSince[i])
+			}
+		}
+		f.buffered -= len(hq.tasks) - len(kept)
+		hq.tasks, hq.heldSince = kept, keptSince
+		if len(kept) == 0 {
+			heap.Remove(&f.ready, hq.heapIndex)
+			delete(f.hosts, host)
+		}
+	}
+	f.mu.Unlock()
+
+	for _, task := range removed {
+		if err := f.inner.Ack(ctx, task); err != nil {
+			log.Printf("Error acknowledging removed task for %s: %v", task.URL, err)
+		}
+	}
+
+	queued, err := f.inner.RemoveCrawl(ctx, crawlID)
+	return append(removed, queued...), err
+}
+
+// Stats counts the tasks of the inner queue. Tasks buffered locally are in
+// flight as far as the inner queue knows, but still waiting to be handed out.
+func (f *HostFrontier) Stats(ctx context.Context) (Stats, error) {
+	stats, err := f.inner.Stats(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	for _, hq := range f.hosts {
+		for _, task := range hq.tasks {
+			stats.ByPriority[task.Priority.normalize().String()]++
+		}
+		if hq.readyAt.After(now) {
+			stats.Paced += len(hq.tasks)
+		}
+	}
+	stats.Ready += f.buffered
+	stats.InFlight -= f.buffered
+	if stats.InFlight < 0 {
+		stats.InFlight = 0
+	}
+	return stats, nil
+}
+
+// Release hands every locally buffered task back to the inner queue.
+// Call it once workers have stopped dequeuing.
+func (f *HostFrontier) Release(ctx context.Context) {
+	f.mu.Lock()
+	var tasks []*Task
+	for _, hq := range f.hosts {
+		tasks = append(tasks, hq.tasks...)
+	}
+	f.hosts = make(map[string]*hostQueue)
+	f.ready = nil
+	f.buffered = 0
+	f.mu.Unlock()
+
+	for _, task := range tasks {
+		if err := f.inner.Nack(ctx, task); err != nil {
+			log.Printf("Error releasing buffered task for %s: %v", task.URL, err)
+		}
+	}
+}
+
+// ReadyHosts returns the number of hosts with buffered work that can be fetched now
+func (f *HostFrontier) ReadyHosts() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, hq := range f.ready {
+		if !hq.readyAt.After(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// Close releases buffered tasks and closes the inner queue
+func (f *HostFrontier) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	f.Release(ctx)
+	return f.inner.Close()
+}
+
+// popReady hands out the next buffered task whose host is ready, if any. The
+// tasks of hosts slowed down so much that they can't be handed out before their
+// lease is at risk are pushed back to the inner queue.
+func (f *HostFrontier) popReady() *Task {
+	task, stale := f.nextReady()
+	for _, hq := range stale {
+		interval := f.pacer.Interval(hq.host)
+		for i, staleTask := range hq.tasks {
+			f.deferTask(staleTask, hq.readyAt.Add(time.Duration(i)*interval))
+		}
+	}
+	return task
+}
+
+// nextReady takes the next buffered task whose host is ready, if any, along with
+// the host queues taken out of the rotation because they can't be held any longer
+func (f *HostFrontier) nextReady() (*Task, []*hostQueue) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var stale []*hostQueue
+	for f.ready.Len() > 0 {
+		hq := f.ready[0]
+		if hq.readyAt.After(time.Now()) {
+			return nil, stale
+		}
+
+		// The pacer may have slowed the host down since it was scheduled. Compared
+		// with the time after asking it, since a ready host is ready "now" by its clock.
+		if readyAt := f.readyAt(hq.host); readyAt.After(time.Now()) {
+			hq.readyAt = readyAt
+			if readyAt.Sub(hq.heldSince[0]) >= f.maxHold {
+				heap.Remove(&f.ready, hq.heapIndex)
+				delete(f.hosts, hq.host)
+				f.buffered -= len(hq.tasks)
+				stale = append(stale, hq)
+				continue
+			}
+			heap.Fix(&f.ready, hq.heapIndex)
+			continue
+		}
+
+		task := hq.tasks[0]
+		hq.tasks = hq.tasks[1:]
+		hq.heldSince = hq.heldSince[1:]
+		f.buffered--
+		f.issued(hq.host, time.Now())
+
+		if len(hq.tasks) == 0 {
+			heap.Remove(&f.ready, hq.heapIndex)
+			delete(f.hosts, hq.host)
+		} else {
+			hq.readyAt = f.readyAt(hq.host)
+			heap.Fix(&f.ready, hq.heapIndex)
+		}
+		return task, stale
+	}
+	return nil, stale
+}
+
+// admit decides what to do with a task fresh from the inner queue. It returns
+// true if the task should be handed out right away; otherwise the task has been
+// buffered, or deferred when it would have to wait longer than maxHold.
+func (f *HostFrontier) admit(task *Task) bool {
+	host := taskHost(task)
+
+	f.mu.Lock()
+	hq, buffered := f.hosts[host]
+	readyAt := f.readyAt(host)
+	now := time.Now()
+	if !buffered && !readyAt.After(now) {
+		f.issued(host, now)
+		f.mu.Unlock()
+		return true
+	}
+
+	// When the host will have worked through what is already buffered for it
+	queued := 0
+	if buffered {
+		queued = len(hq.tasks)
+	}
+	notBefore := readyAt.Add(time.Duration(queued) * f.pacer.Interval(host))
+
+	// Only buffer a task that goes out well before its lease in the inner queue runs out
+	if notBefore.Sub(now) < f.maxHold {
+		if !buffered && f.buffered < f.maxBuffered {
+			hq = &hostQueue{host: host, readyAt: readyAt}
+			f.hosts[host] = hq
+			heap.Push(&f.ready, hq)
+			buffered = true
+		}
+		if buffered && len(hq.tasks) < f.maxPerHost {
+			hq.tasks = append(hq.tasks, task)
+			hq.heldSince = append(hq.heldSince, now)
+			f.buffered++
+			f.mu.Unlock()
+			return false
+		}
+	}
+
+	// The host already has enough work lined up or won't be ready for a while,
+	// push the task back to become due about when the host will take it
+	f.mu.Unlock()
+
+	f.deferTask(task, notBefore)
+	return false
+}
+
+// deferTask re-enqueues a task as a delayed task and acknowledges the original delivery
+func (f *HostFrontier) deferTask(task *Task, notBefore time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	deferred := *task
+	deferred.NotBefore = notBefore
+	if err := f.inner.Enqueue(ctx, &deferred); err != nil {
+		log.Printf("Error deferring task for %s: %v", task.URL, err)
+		f.inner.Nack(ctx, task)
+		return
+	}
+	if err := f.inner.Ack(ctx, task); err != nil {
+		log.Printf("Error acknowledging deferred task for %s: %v", task.URL, err)
+	}
+}
+
+// readyAt returns when the host may next be handed out: not before the pacer
+// allows it and not sooner than one interval after the previous hand-out, since
+// the worker that received it may not have reached the rate limiter yet.
+// Must be called with f.mu held.
+func (f *HostFrontier) readyAt(host string) time.Time {
+	readyAt := f.pacer.NextAllowed(host)
+	if last, ok := f.lastIssued[host]; ok {
+		if next := last.Add(f.pacer.Interval(host)); next.After(readyAt) {
+			readyAt = next
+		}
+	}
+	return readyAt
+}
+
+// issued records a hand-out for the host and forgets hosts idle for a while.
+// Must be called with f.mu held.
+func (f *HostFrontier) issued(host string, now time.Time) {
+	f.lastIssued[host] = now
+	if len(f.lastIssued) > 10*f.maxBuffered {
+		for h, last := range f.lastIssued {
+			if _, buffered := f.hosts[h]; !buffered && now.Sub(last) > f.pacer.Interval(h) {
+				delete(f.lastIssued, h)
+			}
+		}
+	}
+}
+
+// taskHost returns the host a task will be fetched from, as the crawler's rate limiter keys it
+func taskHost(task *Task) string {
+	u, err := url.Parse(task.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,52 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testPacer spaces fetches to one host by a fixed interval, like the crawler's
+// rate limiter: a ready host is ready as of the moment it is asked
+type testPacer struct {
+	interval time.Duration
+	last     time.Time
+}
+
+func (p *testPacer) NextAllowed(host string) time.Time {
+	now := time.Now()
+	if next := p.last.Add(p.interval); next.After(now) {
+		return next
+	}
+	return now
+}
+
+func (p *testPacer) Interval(host string) time.Duration { return p.interval }
+
+func TestHostFrontierHandsOutBufferedTaskOnceHostIsReady(t *testing.T) {
+	pacer := &testPacer{interval: 20 * time.Millisecond}
+	f := NewHostFrontier(NewMemoryQueue(), pacer, 400*time.Millisecond)
+	ctx := context.Background()
+
+	for _, u := range []string{"https://example.com/a", "https://example.com/b"} {
+		if err := f.Enqueue(ctx, NewTask(u)); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	first, err := f.Dequeue(ctx)
+	if err != nil || first == nil {
+		t.Fatalf("first Dequeue returned %v, %v, want a task", first, err)
+	}
+	pacer.last = time.Now()
+
+	// The second task is buffered until the host's interval is up, well within its lease
+	start := time.Now()
+	second, err := f.Dequeue(ctx)
+	if err != nil || second == nil {
+		t.Fatalf("second Dequeue returned %v, %v, want the buffered task", second, err)
+	}
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Fatalf("buffered task handed out after %v, want about %v", elapsed, pacer.interval)
+	}
+}
@@ -1,45 +1,161 @@
 package queue
 
 import (
+	"container/heap"
 	"context"
+	"strconv"
 	"sync"
+	"time"
 )
 
 // MemoryQueue implements the Queue interface using in-memory storage
 // This is primarily for testing purposes or when Redis is not available
 type MemoryQueue struct {
-	queue []string
-	mu    sync.Mutex
+	queues    [][]*Task        // One FIFO per priority level, indexed like priorityLevels
+	delayed   delayedHeap      // Tasks waiting for their NotBefore time
+	inFlight  map[string]*Task // Dequeued tasks awaiting Ack or Nack, by lease ID
+	nextLease uint64
+	scheduler *priorityScheduler
+	mu        sync.Mutex
 }
 
 // NewMemoryQueue creates a new in-memory queue
 func NewMemoryQueue() Queue {
 	return &MemoryQueue{
-		queue: make([]string, 0),
+		queues:    make([][]*Task, len(priorityLevels)),
+		inFlight:  make(map[string]*Task),
+		scheduler: newPriorityScheduler(),
 	}
 }
 
-// Enqueue adds a URL to the queue
-func (q *MemoryQueue) Enqueue(ctx context.Context, url string) error {
+// Enqueue adds a task to the queue
+func (q *MemoryQueue) Enqueue(ctx context.Context, task *Task) error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 	
-	q.queue = append(q.queue, url)
+	// Store a copy so callers can't mutate queued tasks
+	queued := *task
+	if queued.IsDelayed(time.Now()) {
+		heap.Push(&q.delayed, &queued)
+		return nil
+	}
+	q.push(&queued)
 	return nil
 }
 
-// Dequeue retrieves and removes a URL from the queue
-func (q *MemoryQueue) Dequeue(ctx context.Context) (string, error) {
+// Dequeue retrieves and removes a task from the queue, choosing the priority
+// level by weighted round robin so lower levels still progress
+func (q *MemoryQueue) Dequeue(ctx context.Context) (*Task, error) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 	
-	if len(q.queue) == 0 {
-		return "", nil // Return empty string for empty queue
+	// Promote delayed tasks that are now due
+	for _, due := range q.delayed.popDue(time.Now()) {
+		q.push(due)
 	}
-	
-	url := q.queue[0]
-	q.queue = q.queue[1:]
-	return url, nil
+
+	var task *Task
+	for _, i := range q.scheduler.order() {
+		if len(q.queues[i]) > 0 {
+			task = q.queues[i][0]
+			q.queues[i] = q.queues[i][1:]
+			break
+		}
+	}
+	if task == nil {
+		return nil, nil // Return nil for empty queue
+	}
+
+	q.nextLease++
+	task.leaseID = strconv.FormatUint(q.nextLease, 10)
+	q.inFlight[task.leaseID] = task
+
+	// Hand out a copy so a Nack requeues the task as it was enqueued
+	delivered := *task
+	return &delivered, nil
+}
+
+// Ack marks a dequeued task as done
+func (q *MemoryQueue) Ack(ctx context.Context, task *Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.inFlight, task.leaseID)
+	return nil
+}
+
+// Nack puts a dequeued task back at the head of the queue
+func (q *MemoryQueue) Nack(ctx context.Context, task *Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queued, ok := q.inFlight[task.leaseID]
+	if !ok {
+		return nil
+	}
+	delete(q.inFlight, task.leaseID)
+	queued.leaseID = ""
+	i := levelIndex(queued.Priority)
+	q.queues[i] = append([]*Task{queued}, q.queues[i]...)
+	return nil
+}
+
+// RemoveCrawl removes the queued and delayed tasks of a crawl
+func (q *MemoryQueue) RemoveCrawl(ctx context.Context, crawlID string) ([]*Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var removed []*Task
+	for i, tasks := range q.queues {
+		kept := tasks[:0]
+		for _, task := range tasks {
+			if task.CrawlID == crawlID {
+				removed = append(removed, task)
+			} else {
+				kept = append(kept, task)
+			}
+		}
+		q.queues[i] = kept
+	}
+
+	kept := q.delayed[:0]
+	for _, task := range q.delayed {
+		if task.CrawlID == crawlID {
+			removed = append(removed, task)
+		} else {
+			kept = append(kept, task)
+		}
+	}
+	q.delayed = kept
+	heap.Init(&q.delayed)
+
+	return removed, nil
+}
+
+// Stats counts the queued, delayed and in-flight tasks
+func (q *MemoryQueue) Stats(ctx context.Context) (Stats, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := Stats{
+		Delayed:    len(q.delayed),
+		InFlight:   len(q.inFlight),
+		ByPriority: make(map[string]int, len(priorityLevels)),
+	}
+	for i, level := range priorityLevels {
+		stats.Ready += len(q.queues[i])
+		stats.ByPriority[level.String()] += len(q.queues[i])
+	}
+	for _, task := range q.delayed {
+		stats.ByPriority[task.Priority.normalize().String()]++
+	}
+	return stats, nil
+}
+
+// push appends a task to the FIFO of its priority level
+func (q *MemoryQueue) push(task *Task) {
+	i := levelIndex(task.Priority)
+	q.queues[i] = append(q.queues[i], task)
 }
 
 // Close is a no-op for memory queue
@@ -0,0 +1,119 @@
+package queue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Priority orders tasks in the queue, higher values are served first
+type Priority int
+
+const (
+	PriorityRecrawl    Priority = iota + 1 // Revisits of pages already crawled
+	PriorityDiscovered                     // Links discovered on crawled pages (the default)
+	PrioritySitemap                        // URLs listed in sitemaps
+	PriorityOperator                       // URLs submitted by an operator
+)
+
+// priorityLevels lists every level from highest to lowest, the index of a level
+// in this slice is how backends address its sub-queue
+var priorityLevels = []Priority{PriorityOperator, PrioritySitemap, PriorityDiscovered, PriorityRecrawl}
+
+// priorityWeights is the share of dequeues each level is offered when every
+// level has work, so lower levels keep progressing under a steady high-priority load
+var priorityWeights = map[Priority]int{
+	PriorityOperator:   8,
+	PrioritySitemap:    4,
+	PriorityDiscovered: 2,
+	PriorityRecrawl:    1,
+}
+
+var priorityNames = map[Priority]string{
+	PriorityOperator:   "operator",
+	PrioritySitemap:    "sitemap",
+	PriorityDiscovered: "discovered",
+	PriorityRecrawl:    "recrawl",
+}
+
+// String returns the name of the priority level
+func (p Priority) String() string {
+	if name, ok := priorityNames[p]; ok {
+		return name
+	}
+	return strconv.Itoa(int(p))
+}
+
+// ParsePriority parses a priority level from its name or number
+func ParsePriority(s string) (Priority, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for p, name := range priorityNames {
+		if s == name {
+			return p, nil
+		}
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if _, ok := priorityNames[Priority(n)]; ok {
+			return Priority(n), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid priority %q (use operator, sitemap, discovered or recrawl)", s)
+}
+
+// normalize maps unset or unknown priorities to the default level
+func (p Priority) normalize() Priority {
+	if _, ok := priorityNames[p]; !ok {
+		return PriorityDiscovered
+	}
+	return p
+}
+
+// levelIndex returns the index of a priority in priorityLevels
+func levelIndex(p Priority) int {
+	p = p.normalize()
+	for i, level := range priorityLevels {
+		if level == p {
+			return i
+		}
+	}
+	return levelIndex(PriorityDiscovered)
+}
+
+// priorityScheduler picks which level to serve next using smooth weighted
+// round robin, so every level gets its weighted share of dequeues
+type priorityScheduler struct {
+	mu      sync.Mutex
+	current []int
+}
+
+func newPriorityScheduler() *priorityScheduler {
+	return &priorityScheduler{current: make([]int, len(priorityLevels))}
+}
+
+// order returns the level indices to try for the next dequeue: the level whose
+// turn it is first, then the remaining levels from highest to lowest priority
+func (s *priorityScheduler) order() []int {
+	s.mu.Lock()
+	total := 0
+	picked := 0
+	for i, level := range priorityLevels {
+		weight := priorityWeights[level]
+		s.current[i] += weight
+		total += weight
+		if s.current[i] > s.current[picked] {
+			picked = i
+		}
+	}
+	s.current[picked] -= total
+	s.mu.Unlock()
+
+	order := make([]int, 0, len(priorityLevels))
+	order = append(order, picked)
+	for i := range priorityLevels {
+		if i != picked {
+			order = append(order, i)
+		}
+	}
+	return order
+}
@@ -2,6 +2,11 @@ package queue
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/MunishMummadi/web-scrapper/config"
@@ -9,21 +14,115 @@ import (
 )
 
 const (
-	defaultQueueKey = "scraper:url_queue"
-	defaultTimeout  = 1 * time.Second // Reduced timeout for blocking dequeue
+	defaultQueueKey       = "scraper:url_queue"
+	processingKeySuffix   = ":processing"   // Hash of lease ID -> payload for in-flight tasks
+	leasesKeySuffix       = ":leases"       // Sorted set of lease ID scored by lease expiry (unix ms)
+	delayedKeySuffix      = ":delayed"      // Per-level sorted set of payloads scored by their not-before time (unix ms)
+	promoteBatchSize      = 100
+	removeBatchSize       = 500
+	defaultTimeout        = 1 * time.Second // Reduced timeout for blocking dequeue
+	reaperBatchSize       = 100
+	defaultVisibility     = 5 * time.Minute
+	defaultReaperInterval = 30 * time.Second
 )
 
-// Queue defines the interface for a job queue
+// Queue defines the interface for a job queue with at-least-once delivery.
+// Dequeue returns a nil task without error when the queue is empty. Every
+// dequeued task must be settled with Ack once it has been fully handled, or
+// with Nack to hand it back to the queue for immediate redelivery.
+// RemoveCrawl takes every queued or delayed task of a crawl off the queue and
+// returns them; tasks already in flight are left alone. Stats counts the tasks
+// the queue holds.
 type Queue interface {
-	Enqueue(ctx context.Context, url string) error
-	Dequeue(ctx context.Context) (string, error)
+	Enqueue(ctx context.Context, task *Task) error
+	Dequeue(ctx context.Context) (*Task, error)
+	Ack(ctx context.Context, task *Task) error
+	Nack(ctx context.Context, task *Task) error
+	RemoveCrawl(ctx context.Context, crawlID string) ([]*Task, error)
+	Stats(ctx context.Context) (Stats, error)
 	Close() error
 }
 
-// RedisQueue implements the Queue interface using Redis
+// Every script below addresses the queue through the same KEYS layout:
+// KEYS[1] is the processing hash, KEYS[2] the leases sorted set, and each
+// priority level i (1-based, highest first) owns KEYS[1+2*i] as its list and
+// KEYS[2+2*i] as its delayed set. A lease ID is prefixed with the level it was
+// popped from ("<i>:<random>") so the payload can be returned to the right list.
+
+// dequeueScript moves delayed payloads due by ARGV[3] onto their lists, then
+// pops the next payload trying the levels in the order given by ARGV[5..] and
+// records it as in-flight under a lease that expires at ARGV[2], all in one
+// atomic step. It returns {lease, payload}.
+var dequeueScript = redis.NewScript(`
+local levels = (#KEYS - 2) / 2
+for i = 1, levels do
+	local due = redis.call('ZRANGEBYSCORE', KEYS[2 + 2 * i], '-inf', ARGV[3], 'LIMIT', 0, ARGV[4])
+	for _, delayed in ipairs(due) do
+		redis.call('LPUSH', KEYS[1 + 2 * i], delayed)
+		redis.call('ZREM', KEYS[2 + 2 * i], delayed)
+	end
+end
+for n = 5, #ARGV do
+	local i = tonumber(ARGV[n])
+	local payload = redis.call('RPOP', KEYS[1 + 2 * i])
+	if payload then
+		local lease = i .. ':' .. ARGV[1]
+		redis.call('HSET', KEYS[1], lease, payload)
+		redis.call('ZADD', KEYS[2], ARGV[2], lease)
+		return {lease, payload}
+	end
+end
+return false
+`)
+
+// nackScript releases lease ARGV[1] and puts its payload back at the head of
+// its level's list. Leases without a level prefix go back to level ARGV[2].
+var nackScript = redis.NewScript(`
+local lease = ARGV[1]
+local payload = redis.call('HGET', KEYS[1], lease)
+redis.call('HDEL', KEYS[1], lease)
+redis.call('ZREM', KEYS[2], lease)
+if payload then
+	local i = tonumber(string.match(lease, '^(%d+):')) or tonumber(ARGV[2])
+	redis.call('RPUSH', KEYS[1 + 2 * i], payload)
+	return 1
+end
+return 0
+`)
+
+// reapScript requeues up to ARGV[2] in-flight payloads whose lease expired
+// before ARGV[1]. Leases without a level prefix go back to level ARGV[3].
+var reapScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, lease in ipairs(expired) do
+	local payload = redis.call('HGET', KEYS[1], lease)
+	if payload then
+		local i = tonumber(string.match(lease, '^(%d+):')) or tonumber(ARGV[3])
+		redis.call('RPUSH', KEYS[1 + 2 * i], payload)
+		redis.call('HDEL', KEYS[1], lease)
+	end
+	redis.call('ZREM', KEYS[2], lease)
+end
+return #expired
+`)
+
+// RedisQueue implements the Queue interface using Redis.
+// Each priority level has its own list (the default level keeps the original
+// scraper:url_queue key so entries queued by older versions are still served)
+// and its own sorted set of delayed tasks. Dequeued tasks stay in a processing
+// hash under a lease until they are acknowledged. A background reaper puts
+// tasks whose lease expired (because the worker crashed or was killed
+// mid-fetch) back on the queue.
 type RedisQueue struct {
-	client  *redis.Client
-	queueKey string
+	client            *redis.Client
+	queueKey          string
+	processingKey     string
+	leasesKey         string
+	keys              []string // Script KEYS layout, see dequeueScript
+	scheduler         *priorityScheduler
+	visibilityTimeout time.Duration
+	stopReaper        chan struct{}
+	closeOnce         sync.Once
 }
 
 // NewRedisQueue creates a new Redis-based queue
@@ -41,60 +140,306 @@ func NewRedisQueue(cfg config.RedisConfig) (Queue, error) {
 		return nil, err
 	}
 
-	return &RedisQueue{
-		client:   client,
-		queueKey: defaultQueueKey,
-	}, nil
+	visibility := cfg.VisibilityTimeout
+	if visibility <= 0 {
+		visibility = defaultVisibility
+	}
+	reaperInterval := cfg.ReaperInterval
+	if reaperInterval <= 0 {
+		reaperInterval = defaultReaperInterval
+	}
+
+	q := &RedisQueue{
+		client:            client,
+		queueKey:          defaultQueueKey,
+		processingKey:     defaultQueueKey + processingKeySuffix,
+		leasesKey:         defaultQueueKey + leasesKeySuffix,
+		scheduler:         newPriorityScheduler(),
+		visibilityTimeout: visibility,
+		stopReaper:        make(chan struct{}),
+	}
+	q.keys = []string{q.processingKey, q.leasesKey}
+	for _, level := range priorityLevels {
+		q.keys = append(q.keys, q.listKey(level), q.listKey(level)+delayedKeySuffix)
+	}
+
+	// Recover anything left in flight by a previous run before workers start
+	q.reapExpired(context.Background())
+	go q.reaper(reaperInterval)
+
+	return q, nil
 }
 
-// Enqueue adds a URL to the end of the Redis list (queue)
-func (q *RedisQueue) Enqueue(ctx context.Context, url string) error {
-	return q.client.LPush(ctx, q.queueKey, url).Err()
+// listKey returns the Redis list holding tasks of a priority level
+func (q *RedisQueue) listKey(p Priority) string {
+	p = p.normalize()
+	if p == PriorityDiscovered {
+		return q.queueKey
+	}
+	return q.queueKey + ":" + p.String()
 }
 
-// Dequeue retrieves and removes a URL from the front of the Redis list (queue)
+// Enqueue adds a task to the end of its priority level's Redis list. Tasks
+// with a future NotBefore wait in the level's delayed set until they are due.
+func (q *RedisQueue) Enqueue(ctx context.Context, task *Task) error {
+	payload, err := task.Encode()
+	if err != nil {
+		return err
+	}
+	listKey := q.listKey(task.Priority)
+	if task.IsDelayed(time.Now()) {
+		score := float64(task.NotBefore.UnixMilli())
+		return q.client.ZAdd(ctx, listKey+delayedKeySuffix, &redis.Z{Score: score, Member: payload}).Err()
+	}
+	return q.client.LPush(ctx, listKey, payload).Err()
+}
+
+// Dequeue retrieves and removes a task from the front of a Redis list (queue),
+// choosing the priority level by weighted round robin so lower levels still progress.
 // It uses a short timeout to avoid long-blocking operations that might cause context timeouts
-func (q *RedisQueue) Dequeue(ctx context.Context) (string, error) {
+func (q *RedisQueue) Dequeue(ctx context.Context) (*Task, error) {
 	// First, check if the context is already expired/cancelled
 	if ctx.Err() != nil {
-		return "", ctx.Err()
+		return nil, ctx.Err()
 	}
 
 	// Create a local timeout that's shorter than the context timeout
-	// This prevents long blocks on BRPop that can lead to context deadline errors
+	// This prevents long blocks that can lead to context deadline errors
 	localCtx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
-	// Use BRPOP with a short timeout
-	result, err := q.client.BRPop(localCtx, defaultTimeout, q.queueKey).Result()
-	
+	// Pop the next task into the processing hash under a fresh lease
+	now := time.Now()
+	args := []interface{}{newID(), now.Add(q.visibilityTimeout).UnixMilli(), now.UnixMilli(), promoteBatchSize}
+	for _, i := range q.scheduler.order() {
+		args = append(args, i+1) // Lua levels are 1-based
+	}
+	result, err := dequeueScript.Run(localCtx, q.client, q.keys, args...).StringSlice()
+
 	// Handle specific errors
 	if err != nil {
-		// redis.Nil indicates timeout or empty queue - not an error condition
+		// redis.Nil indicates an empty queue - not an error condition
 		if err == redis.Nil {
-			// Sleep a small amount to prevent tight polling when queue is empty
-			time.Sleep(100 * time.Millisecond)
-			return "", nil // Return empty string, worker can retry
+			// Wait a little to prevent tight polling when queue is empty, unless ctx ends first
+			timer := time.NewTimer(100 * time.Millisecond)
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+			case <-timer.C:
+			}
+			return nil, nil // Return no task, worker can retry
 		}
 		
 		// Context cancellation or deadline exceeded - this is probably from our local context
 		if err == context.Canceled || err == context.DeadlineExceeded {
-			return "", nil // Not a real error, just empty queue
+			return nil, nil // Not a real error, just empty queue
 		}
 		
 		// For other Redis errors, return them
-		return "", err
+		return nil, err
 	}
 
-	// BRPop returns a slice [key, value]
 	if len(result) < 2 {
-		// Should not happen with BRPop but handle defensively
-		return "", nil
+		// Should not happen with our script but handle defensively
+		return nil, nil
+	}
+	leaseID, payload := result[0], result[1]
+
+	// Entries pushed before tasks existed are bare URLs, DecodeTask handles both
+	task, err := DecodeTask(payload)
+	if err != nil {
+		// An undecodable payload can never succeed, drop it rather than redeliver it forever
+		q.client.HDel(ctx, q.processingKey, leaseID)
+		q.client.ZRem(ctx, q.leasesKey, leaseID)
+		return nil, err
+	}
+	task.leaseID = leaseID
+	return task, nil
+}
+
+// Ack removes a dequeued task from the processing hash for good
+func (q *RedisQueue) Ack(ctx context.Context, task *Task) error {
+	if task.leaseID == "" {
+		return nil
+	}
+	_, err := q.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HDel(ctx, q.processingKey, task.leaseID)
+		pipe.ZRem(ctx, q.leasesKey, task.leaseID)
+		return nil
+	})
+	return err
+}
+
+// Nack releases a dequeued task back to the head of the queue.
+// It is a no-op if the lease already expired and the reaper requeued the task.
+func (q *RedisQueue) Nack(ctx context.Context, task *Task) error {
+	if task.leaseID == "" {
+		return nil
+	}
+	defaultLevel := levelIndex(PriorityDiscovered) + 1
+	return nackScript.Run(ctx, q.client, q.keys, task.leaseID, defaultLevel).Err()
+}
+
+// RemoveCrawl removes the queued and delayed tasks of a crawl from every
+// priority level. Lists are walked page by page and each match is removed by
+// value, so tasks a worker pops meanwhile are simply not counted. Workers pop
+// from the tail and new tasks arrive at the head, which only ever shifts
+// entries the walk has already seen.
+func (q *RedisQueue) RemoveCrawl(ctx context.Context, crawlID string) ([]*Task, error) {
+	var removed []*Task
+	for _, level := range priorityLevels {
+		listKey := q.listKey(level)
+		tasks, err := q.removeFromList(ctx, listKey, crawlID)
+		removed = append(removed, tasks...)
+		if err != nil {
+			return removed, err
+		}
+		tasks, err = q.removeFromDelayed(ctx, listKey+delayedKeySuffix, crawlID)
+		removed = append(removed, tasks...)
+		if err != nil {
+			return removed, err
+		}
 	}
-	return result[1], nil // Return the URL
+	return removed, nil
 }
 
-// Close closes the Redis client connection
+// removeFromList removes the tasks of a crawl from a priority level's list
+func (q *RedisQueue) removeFromList(ctx context.Context, key, crawlID string) ([]*Task, error) {
+	var removed []*Task
+	start := int64(0)
+	for {
+		payloads, err := q.client.LRange(ctx, key, start, start+removeBatchSize-1).Result()
+		if err != nil {
+			return removed, fmt.Errorf("failed to read queue %s: %w", key, err)
+		}
+		kept := int64(len(payloads))
+		for _, payload := range payloads {
+			task, err := DecodeTask(payload)
+			if err != nil || task.CrawlID != crawlID {
+				continue
+			}
+			n, err := q.client.LRem(ctx, key, 1, payload).Result()
+			if err != nil {
+				return removed, fmt.Errorf("failed to remove task for %s: %w", task.URL, err)
+			}
+			if n > 0 {
+				removed = append(removed, task)
+				kept--
+			}
+		}
+		if len(payloads) < removeBatchSize {
+			return removed, nil
+		}
+		start += kept
+	}
+}
+
+// removeFromDelayed removes the tasks of a crawl from a priority level's delayed set
+func (q *RedisQueue) removeFromDelayed(ctx context.Context, key, crawlID string) ([]*Task, error) {
+	var removed []*Task
+	var cursor uint64
+	for {
+		// ZSCAN returns member and score pairs
+		pairs, next, err := q.client.ZScan(ctx, key, cursor, "", removeBatchSize).Result()
+		if err != nil {
+			return removed, fmt.Errorf("failed to read delayed tasks %s: %w", key, err)
+		}
+		for i := 0; i < len(pairs); i += 2 {
+			task, err := DecodeTask(pairs[i])
+			if err != nil || task.CrawlID != crawlID {
+				continue
+			}
+			n, err := q.client.ZRem(ctx, key, pairs[i]).Result()
+			if err != nil {
+				return removed, fmt.Errorf("failed to remove task for %s: %w", task.URL, err)
+			}
+			if n > 0 {
+				removed = append(removed, task)
+			}
+		}
+		if next == 0 {
+			return removed, nil
+		}
+		cursor = next
+	}
+}
+
+// Stats counts the tasks in every priority level's list and delayed set and
+// the leased tasks in the processing hash
+func (q *RedisQueue) Stats(ctx context.Context) (Stats, error) {
+	var lists, delayed []*redis.IntCmd
+	var processing *redis.IntCmd
+	_, err := q.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, level := range priorityLevels {
+			listKey := q.listKey(level)
+			lists = append(lists, pipe.LLen(ctx, listKey))
+			delayed = append(delayed, pipe.ZCard(ctx, listKey+delayedKeySuffix))
+		}
+		processing = pipe.HLen(ctx, q.processingKey)
+		return nil
+	})
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to get queue stats: %w", err)
+	}
+
+	stats := Stats{
+		InFlight:   int(processing.Val()),
+		ByPriority: make(map[string]int, len(priorityLevels)),
+	}
+	for i, level := range priorityLevels {
+		ready, waiting := int(lists[i].Val()), int(delayed[i].Val())
+		stats.Ready += ready
+		stats.Delayed += waiting
+		stats.ByPriority[level.String()] = ready + waiting
+	}
+	return stats, nil
+}
+
+// reaper periodically requeues tasks whose lease has expired
+func (q *RedisQueue) reaper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.stopReaper:
+			return
+		case <-ticker.C:
+			q.reapExpired(context.Background())
+		}
+	}
+}
+
+// reapExpired requeues every in-flight task whose lease has expired
+func (q *RedisQueue) reapExpired(ctx context.Context) {
+	defaultLevel := levelIndex(PriorityDiscovered) + 1
+	for {
+		now := time.Now().UnixMilli()
+		n, err := reapScript.Run(ctx, q.client, q.keys, now, reaperBatchSize, defaultLevel).Int()
+		if err != nil {
+			log.Printf("Error requeuing expired tasks: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("Requeued %d tasks with expired leases", n)
+		}
+		if n < reaperBatchSize {
+			return
+		}
+	}
+}
+
+// Close stops the reaper and closes the Redis client connection
 func (q *RedisQueue) Close() error {
+	q.closeOnce.Do(func() { close(q.stopReaper) })
 	return q.client.Close()
 }
+
+// newID generates a random identifier for leases and dead-letter entries
+func newID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return hex.EncodeToString([]byte(time.Now().String()))
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,252 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/config"
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestRedisQueue starts a miniredis server and a RedisQueue on top of it.
+// The reaper only runs when a test calls reapExpired.
+func newTestRedisQueue(t *testing.T, visibility time.Duration) (*RedisQueue, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	port, err := strconv.Atoi(mr.Port())
+	if err != nil {
+		t.Fatalf("invalid miniredis port %q: %v", mr.Port(), err)
+	}
+
+	q, err := NewRedisQueue(config.RedisConfig{
+		Host:              mr.Host(),
+		Port:              port,
+		VisibilityTimeout: visibility,
+		ReaperInterval:    time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewRedisQueue: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q.(*RedisQueue), mr
+}
+
+// mustDequeue dequeues a task and fails the test if there is none
+func mustDequeue(t *testing.T, q *RedisQueue) *Task {
+	t.Helper()
+	task, err := q.Dequeue(context.Background())
+	if err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	if task == nil {
+		t.Fatal("Dequeue returned no task")
+	}
+	return task
+}
+
+// assertEmpty fails the test if a task can be dequeued
+func assertEmpty(t *testing.T, q *RedisQueue) {
+	t.Helper()
+	task, err := q.Dequeue(context.Background())
+	if err != nil {
+		t.Fatalf("Dequeue: %v", err)
+	}
+	if task != nil {
+		t.Fatalf("Dequeue returned %s, want no task", task.URL)
+	}
+}
+
+// inFlight returns the number of leased tasks in the processing hash and the leases set
+func inFlight(t *testing.T, q *RedisQueue) (int, int) {
+	t.Helper()
+	ctx := context.Background()
+	processing, err := q.client.HLen(ctx, q.processingKey).Result()
+	if err != nil {
+		t.Fatalf("HLEN: %v", err)
+	}
+	leases, err := q.client.ZCard(ctx, q.leasesKey).Result()
+	if err != nil {
+		t.Fatalf("ZCARD: %v", err)
+	}
+	return int(processing), int(leases)
+}
+
+func TestRedisQueueAck(t *testing.T) {
+	q, _ := newTestRedisQueue(t, time.Minute)
+	ctx := context.Background()
+
+	if err := q.Enqueue(ctx, NewTask("https://example.com/a")); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	task := mustDequeue(t, q)
+	if task.URL != "https://example.com/a" {
+		t.Fatalf("dequeued %s, want https://example.com/a", task.URL)
+	}
+	if processing, leases := inFlight(t, q); processing != 1 || leases != 1 {
+		t.Fatalf("in flight after Dequeue: %d tasks, %d leases, want 1 and 1", processing, leases)
+	}
+
+	if err := q.Ack(ctx, task); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	if processing, leases := inFlight(t, q); processing != 0 || leases != 0 {
+		t.Fatalf("in flight after Ack: %d tasks, %d leases, want none", processing, leases)
+	}
+
+	// An acknowledged task is never redelivered, not even by the reaper
+	q.reapExpired(ctx)
+	assertEmpty(t, q)
+}
+
+func TestRedisQueueNack(t *testing.T) {
+	q, mr := newTestRedisQueue(t, time.Minute)
+	ctx := context.Background()
+
+	task := NewTask("https://example.com/a")
+	task.Priority = PriorityOperator
+	if err := q.Enqueue(ctx, task); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	dequeued := mustDequeue(t, q)
+
+	if err := q.Nack(ctx, dequeued); err != nil {
+		t.Fatalf("Nack: %v", err)
+	}
+	if processing, leases := inFlight(t, q); processing != 0 || leases != 0 {
+		t.Fatalf("in flight after Nack: %d tasks, %d leases, want none", processing, leases)
+	}
+	// The task goes back to the level it was taken from
+	if payloads, _ := mr.List(q.listKey(PriorityOperator)); len(payloads) != 1 {
+		t.Fatalf("operator list holds %d tasks after Nack, want 1", len(payloads))
+	}
+
+	redelivered := mustDequeue(t, q)
+	if redelivered.URL != task.URL || redelivered.Priority != PriorityOperator {
+		t.Fatalf("redelivered %s at %s, want %s at operator", redelivered.URL, redelivered.Priority, task.URL)
+	}
+
+	// Settling a delivery twice is harmless
+	if err := q.Nack(ctx, dequeued); err != nil {
+		t.Fatalf("second Nack: %v", err)
+	}
+	if err := q.Ack(ctx, redelivered); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	assertEmpty(t, q)
+}
+
+func TestRedisQueueReapsExpiredLeases(t *testing.T) {
+	q, _ := newTestRedisQueue(t, 50*time.Millisecond)
+	ctx := context.Background()
+
+	if err := q.Enqueue(ctx, NewTask("https://example.com/a")); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	lost := mustDequeue(t, q)
+
+	// A lease that hasn't expired yet is left alone
+	q.reapExpired(ctx)
+	assertEmpty(t, q)
+
+	time.Sleep(100 * time.Millisecond)
+	q.reapExpired(ctx)
+	if processing, leases := inFlight(t, q); processing != 0 || leases != 0 {
+		t.Fatalf("in flight after reaping: %d tasks, %d leases, want none", processing, leases)
+	}
+
+	redelivered := mustDequeue(t, q)
+	if redelivered.URL != lost.URL {
+		t.Fatalf("redelivered %s, want %s", redelivered.URL, lost.URL)
+	}
+
+	// The worker holding the expired lease settling late doesn't touch the new delivery
+	if err := q.Ack(ctx, lost); err != nil {
+		t.Fatalf("late Ack: %v", err)
+	}
+	if processing, _ := inFlight(t, q); processing != 1 {
+		t.Fatalf("%d tasks in flight after a late Ack, want the redelivered one", processing)
+	}
+}
+
+func TestRedisQueueDelayedTasks(t *testing.T) {
+	q, _ := newTestRedisQueue(t, time.Minute)
+	ctx := context.Background()
+
+	task := NewTask("https://example.com/a")
+	task.NotBefore = time.Now().Add(100 * time.Millisecond)
+	if err := q.Enqueue(ctx, task); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	assertEmpty(t, q)
+
+	time.Sleep(150 * time.Millisecond)
+	if dequeued := mustDequeue(t, q); dequeued.URL != task.URL {
+		t.Fatalf("dequeued %s, want %s", dequeued.URL, task.URL)
+	}
+}
+
+func TestRedisQueueLegacyEntries(t *testing.T) {
+	q, mr := newTestRedisQueue(t, time.Minute)
+
+	mr.Lpush(defaultQueueKey, "https://example.com/legacy")
+	task := mustDequeue(t, q)
+	if task.URL != "https://example.com/legacy" {
+		t.Fatalf("dequeued %s, want https://example.com/legacy", task.URL)
+	}
+
+	// Nacked legacy entries go back to the default level
+	if err := q.Nack(context.Background(), task); err != nil {
+		t.Fatalf("Nack: %v", err)
+	}
+	if payloads, _ := mr.List(defaultQueueKey); len(payloads) != 1 {
+		t.Fatalf("default list holds %d tasks after Nack, want 1", len(payloads))
+	}
+}
+
+func TestRedisQueueRemoveCrawl(t *testing.T) {
+	q, _ := newTestRedisQueue(t, time.Minute)
+	ctx := context.Background()
+
+	for i, crawlID := range []string{"a", "b", "a", "a"} {
+		task := NewTask("https://example.com/" + strconv.Itoa(i))
+		task.CrawlID = crawlID
+		if i == 3 {
+			task.NotBefore = time.Now().Add(time.Hour)
+		}
+		if err := q.Enqueue(ctx, task); err != nil {
+			t.Fatalf("Enqueue: %v", err)
+		}
+	}
+
+	removed, err := q.RemoveCrawl(ctx, "a")
+	if err != nil {
+		t.Fatalf("RemoveCrawl: %v", err)
+	}
+	if len(removed) != 3 {
+		t.Fatalf("removed %d tasks, want 3", len(removed))
+	}
+
+	task := mustDequeue(t, q)
+	if task.CrawlID != "b" {
+		t.Fatalf("dequeued a task of crawl %q, want b", task.CrawlID)
+	}
+	assertEmpty(t, q)
+}
+
+func TestRedisQueueDequeueHonoursContext(t *testing.T) {
+	q, _ := newTestRedisQueue(t, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	task, err := q.Dequeue(ctx)
+	if err != nil || task != nil {
+		t.Fatalf("Dequeue on an empty queue returned %v, %v, want no task and no error", task, err)
+	}
+	if elapsed := time.Since(start); elapsed >= 90*time.Millisecond {
+		t.Fatalf("Dequeue took %v after its context ended", elapsed)
+	}
+}
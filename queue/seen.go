@@ -0,0 +1,145 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/config"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultSeenKey = "scraper:seen" // Sorted set of canonical URLs scored by when they were first seen (unix ms)
+
+	memorySeenPruneEvery = 10000 // Adds between sweeps of expired entries in the memory seen-set
+)
+
+// SeenSet remembers which URLs have already been enqueued. Add records a URL
+// and reports whether it was new; entries expire after the configured TTL so
+// pages can be crawled again later (a TTL of 0 remembers them forever).
+// Remove forgets a URL, e.g. when it could not be enqueued after all.
+type SeenSet interface {
+	Add(ctx context.Context, url string) (bool, error)
+	Remove(ctx context.Context, url string) error
+	Close() error
+}
+
+// seenAddScript drops expired members, then adds the URL unless it is still present.
+// ARGV[1] is the URL, ARGV[2] the current time and ARGV[3] the expiry cutoff (unix ms, "" for no expiry).
+var seenAddScript = redis.NewScript(`
+if ARGV[3] ~= '' then
+	redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[3])
+end
+if redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+	return 0
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+
+// RedisSeenSet implements SeenSet with a Redis sorted set shared by every crawler node
+type RedisSeenSet struct {
+	client *redis.Client
+	key    string
+	ttl    time.Duration
+}
+
+// NewRedisSeenSet creates a new Redis-based seen-set
+func NewRedisSeenSet(cfg config.RedisConfig, ttl time.Duration) (SeenSet, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address(),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	// Ping Redis to ensure connection is established
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+
+	return &RedisSeenSet{
+		client: client,
+		key:    defaultSeenKey,
+		ttl:    ttl,
+	}, nil
+}
+
+// Add records a URL and reports whether it had not been seen yet
+func (s *RedisSeenSet) Add(ctx context.Context, url string) (bool, error) {
+	now := time.Now()
+	cutoff := ""
+	if s.ttl > 0 {
+		cutoff = strconv.FormatInt(now.Add(-s.ttl).UnixMilli(), 10)
+	}
+	added, err := seenAddScript.Run(ctx, s.client, []string{s.key}, url, now.UnixMilli(), cutoff).Int()
+	if err != nil {
+		return false, err
+	}
+	return added == 1, nil
+}
+
+// Remove forgets a URL
+func (s *RedisSeenSet) Remove(ctx context.Context, url string) error {
+	return s.client.ZRem(ctx, s.key, url).Err()
+}
+
+// Close closes the Redis client connection
+func (s *RedisSeenSet) Close() error {
+	return s.client.Close()
+}
+
+// MemorySeenSet implements SeenSet in memory
+// This is primarily for testing purposes or when Redis is not available
+type MemorySeenSet struct {
+	seen map[string]time.Time
+	ttl  time.Duration
+	adds int
+	mu   sync.Mutex
+}
+
+// NewMemorySeenSet creates a new in-memory seen-set
+func NewMemorySeenSet(ttl time.Duration) SeenSet {
+	return &MemorySeenSet{
+		seen: make(map[string]time.Time),
+		ttl:  ttl,
+	}
+}
+
+// Add records a URL and reports whether it had not been seen yet
+func (s *MemorySeenSet) Add(ctx context.Context, url string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.adds++; s.ttl > 0 && s.adds%memorySeenPruneEvery == 0 {
+		for u, seenAt := range s.seen {
+			if now.Sub(seenAt) > s.ttl {
+				delete(s.seen, u)
+			}
+		}
+	}
+
+	if seenAt, ok := s.seen[url]; ok && (s.ttl <= 0 || now.Sub(seenAt) <= s.ttl) {
+		return false, nil
+	}
+	s.seen[url] = now
+	return true, nil
+}
+
+// Remove forgets a URL
+func (s *MemorySeenSet) Remove(ctx context.Context, url string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.seen, url)
+	return nil
+}
+
+// Close is a no-op for the memory seen-set
+func (s *MemorySeenSet) Close() error {
+	return nil
+}
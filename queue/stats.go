@@ -0,0 +1,15 @@
+package queue
+
+// Stats counts the tasks a queue holds
+type Stats struct {
+	Ready      int            `json:"ready"`       // Tasks that can be dequeued now
+	Delayed    int            `json:"delayed"`     // Tasks waiting for their NotBefore time
+	InFlight   int            `json:"in_flight"`   // Dequeued tasks not settled yet
+	Paced      int            `json:"paced"`       // Ready tasks held by a HostFrontier until their host may be fetched again
+	ByPriority map[string]int `json:"by_priority"` // Ready and delayed tasks per priority level
+}
+
+// Len returns the number of tasks waiting in the queue, ready or delayed
+func (s Stats) Len() int {
+	return s.Ready + s.Delayed
+}
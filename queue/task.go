@@ -0,0 +1,68 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Task is the envelope carried through the queue for every URL to crawl
+type Task struct {
+	URL        string    `json:"url"`
+	Depth      int       `json:"depth,omitempty"`      // Link depth from the crawl's seed
+	ParentURL  string    `json:"parent_url,omitempty"` // Page the URL was discovered on
+	Priority   Priority  `json:"priority,omitempty"`
+	Attempt    int       `json:"attempt,omitempty"`  // Number of fetch attempts made so far
+	CrawlID    string    `json:"crawl_id,omitempty"` // Crawl the URL belongs to
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	NotBefore  time.Time `json:"not_before,omitempty"` // Earliest time the task may be dequeued
+	Recrawl    bool      `json:"recrawl,omitempty"`    // Revisit scheduled by the recrawler, the page's links aren't followed
+
+	// Set for URLs found in a sitemap
+	Sitemap         bool      `json:"sitemap,omitempty"`          // The URL is a sitemap or sitemap index to expand, not a page
+	LastMod         time.Time `json:"lastmod,omitempty"`          // <lastmod> of the sitemap entry
+	SitemapPriority float64   `json:"sitemap_priority,omitempty"` // <priority> of the sitemap entry, 0.0 to 1.0
+
+	leaseID string // Identifies the delivery while the task is in flight
+}
+
+// NewTask creates a task for a URL stamped with the current time
+func NewTask(url string) *Task {
+	return &Task{
+		URL:        url,
+		EnqueuedAt: time.Now(),
+	}
+}
+
+// IsDelayed reports whether the task may not be dequeued yet
+func (t *Task) IsDelayed(now time.Time) bool {
+	return !t.NotBefore.IsZero() && t.NotBefore.After(now)
+}
+
+// Encode serializes the task for storage in a queue backend
+func (t *Task) Encode() (string, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode task for %s: %w", t.URL, err)
+	}
+	return string(data), nil
+}
+
+// DecodeTask deserializes a task. Payloads that are not JSON objects are
+// treated as legacy bare URL entries and wrapped in a task with no metadata.
+func DecodeTask(payload string) (*Task, error) {
+	trimmed := strings.TrimSpace(payload)
+	if !strings.HasPrefix(trimmed, "{") {
+		return &Task{URL: trimmed}, nil
+	}
+
+	var task Task
+	if err := json.Unmarshal([]byte(trimmed), &task); err != nil {
+		return nil, fmt.Errorf("failed to decode task: %w", err)
+	}
+	if task.URL == "" {
+		return nil, fmt.Errorf("failed to decode task: missing url")
+	}
+	return &task, nil
+}
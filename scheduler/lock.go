@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/config"
+	"github.com/go-redis/redis/v8"
+)
+
+const defaultLockPrefix = "scraper:schedule:" // Followed by the schedule name
+
+// Lock makes sure each run of a schedule is fired by a single node. Claim
+// reports whether this node may fire the schedule now; a successful claim
+// holds for ttl, so other nodes skip the same run.
+type Lock interface {
+	Claim(ctx context.Context, name string, ttl time.Duration) (bool, error)
+	Close() error
+}
+
+// MemoryLock implements Lock for a single process, every claim succeeds
+type MemoryLock struct{}
+
+// NewMemoryLock creates a lock for a scheduler that runs on one node only
+func NewMemoryLock() Lock {
+	return MemoryLock{}
+}
+
+// Claim always succeeds, there is no other node to fire the schedule
+func (MemoryLock) Claim(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+// Close is a no-op for the memory lock
+func (MemoryLock) Close() error {
+	return nil
+}
+
+// RedisLock implements Lock with expiring Redis keys shared by every node
+type RedisLock struct {
+	client *redis.Client
+	prefix string
+	owner  string // Identifies this node in the key's value
+}
+
+// NewRedisLock creates a new Redis-based schedule lock
+func NewRedisLock(cfg config.RedisConfig) (Lock, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address(),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	// Ping Redis to ensure connection is established
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	return &RedisLock{
+		client: client,
+		prefix: defaultLockPrefix,
+		owner:  fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+	}, nil
+}
+
+// Claim sets the schedule's key unless another node already holds it
+func (l *RedisLock) Claim(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	claimed, err := l.client.SetNX(ctx, l.prefix+name, l.owner, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim schedule %s: %w", name, err)
+	}
+	return claimed, nil
+}
+
+// Close closes the Redis connection
+func (l *RedisLock) Close() error {
+	return l.client.Close()
+}
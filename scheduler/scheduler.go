@@ -0,0 +1,469 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MunishMummadi/web-scrapper/config"
+	"github.com/MunishMummadi/web-scrapper/crawler"
+	"github.com/MunishMummadi/web-scrapper/database"
+	"github.com/MunishMummadi/web-scrapper/metrics"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// Where a schedule is defined
+	SourceConfig = "config"
+	SourceAPI    = "api"
+
+	// Outcomes recorded when a schedule comes due
+	OutcomeStarted = "started"
+	OutcomeOverlap = "skipped_overlap" // The previous run's crawl is still going
+	OutcomeClaimed = "claimed"         // Another node fired this run
+	OutcomeFailed  = "failed"
+
+	checkInterval = time.Second
+	minClaimTTL   = time.Second
+)
+
+var (
+	ErrInvalidSchedule  = errors.New("invalid schedule")
+	ErrScheduleNotFound = errors.New("schedule not found")
+	ErrScheduleExists   = errors.New("schedule already exists")
+	ErrConfigSchedule   = errors.New("schedule is defined in the config file")
+)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// Scheduler starts crawls when their cron schedules come due
+type Scheduler struct {
+	storage  database.Storage
+	crawler  *crawler.Crawler
+	lock     Lock
+	metrics  *metrics.MetricsCollector
+	defaults *config.CrawlerConfig // Crawl options the schedules' overrides apply to
+
+	mu       sync.Mutex
+	entries  map[string]*entry // Schedules by name
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// entry is a schedule with its parsed cron expression
+type entry struct {
+	schedule database.CrawlSchedule
+	cron     cron.Schedule
+}
+
+// NewScheduler creates a scheduler that starts crawls on the given crawler
+func NewScheduler(s database.Storage, c *crawler.Crawler, lock Lock, m *metrics.MetricsCollector, defaults *config.CrawlerConfig) *Scheduler {
+	return &Scheduler{
+		storage:  s,
+		crawler:  c,
+		lock:     lock,
+		metrics:  m,
+		defaults: defaults,
+		entries:  make(map[string]*entry),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Load stores the schedules defined in the config file, removes config schedules
+// that are no longer defined, and loads every stored schedule
+func (s *Scheduler) Load(ctx context.Context, configured []config.ScheduleConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.storage.GetCrawlSchedules(ctx)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]database.CrawlSchedule, len(stored))
+	for _, schedule := range stored {
+		existing[schedule.Name] = schedule
+	}
+
+	defined := make(map[string]bool, len(configured))
+	for _, cfg := range configured {
+		schedule, err := fromConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("schedule %q: %w", cfg.Name, err)
+		}
+		if defined[schedule.Name] {
+			return fmt.Errorf("schedule %q: %w: defined twice", cfg.Name, ErrInvalidSchedule)
+		}
+		defined[schedule.Name] = true
+
+		previous, ok := existing[schedule.Name]
+		if ok && previous.Source != SourceConfig {
+			return fmt.Errorf("schedule %q: a schedule with that name was created through the API", cfg.Name)
+		}
+		e, err := s.prepare(schedule, previous, ok)
+		if err != nil {
+			return fmt.Errorf("schedule %q: %w", cfg.Name, err)
+		}
+		if err := s.storage.SaveCrawlSchedule(ctx, e.schedule); err != nil {
+			return err
+		}
+		s.entries[schedule.Name] = e
+	}
+
+	for name, schedule := range existing {
+		if defined[name] {
+			continue
+		}
+		if schedule.Source == SourceConfig {
+			log.Printf("Schedule %s was removed from the config, deleting it", name)
+			if err := s.storage.DeleteCrawlSchedule(ctx, name); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+			continue
+		}
+		cronSchedule, err := cron.ParseStandard(schedule.Cron)
+		if err != nil {
+			log.Printf("Skipping schedule %s with invalid cron expression %q: %v", name, schedule.Cron, err)
+			continue
+		}
+		s.entries[name] = &entry{schedule: schedule, cron: cronSchedule}
+	}
+
+	log.Printf("Loaded %d crawl schedules", len(s.entries))
+	return nil
+}
+
+// fromConfig converts a schedule from the config file, only the crawl options
+// it sets are stored as overrides
+func fromConfig(cfg config.ScheduleConfig) (database.CrawlSchedule, error) {
+	overrides := make(map[string]interface{})
+	if cfg.MaxDepth != nil {
+		overrides["max_depth"] = *cfg.MaxDepth
+	}
+	if cfg.MaxPages != nil {
+		overrides["max_pages"] = *cfg.MaxPages
+	}
+	if cfg.MaxPagesPerHost != nil {
+		overrides["max_pages_per_host"] = *cfg.MaxPagesPerHost
+	}
+	if cfg.Scope != nil {
+		overrides["scope"] = cfg.Scope
+	}
+
+	var options string
+	if len(overrides) > 0 {
+		data, err := json.Marshal(overrides)
+		if err != nil {
+			return database.CrawlSchedule{}, fmt.Errorf("failed to encode crawl options: %w", err)
+		}
+		options = string(data)
+	}
+
+	return database.CrawlSchedule{
+		Name:    cfg.Name,
+		Cron:    cfg.Cron,
+		Seeds:   cfg.Seeds,
+		Options: options,
+		Enabled: !cfg.Disabled,
+		Source:  SourceConfig,
+	}, nil
+}
+
+// prepare validates a schedule and carries over the run history of the schedule
+// it replaces, if any. The next run is kept unless the timing changed.
+func (s *Scheduler) prepare(schedule, previous database.CrawlSchedule, replaces bool) (*entry, error) {
+	if !namePattern.MatchString(schedule.Name) {
+		return nil, fmt.Errorf("%w: name must be 1-64 letters, digits, '.', '_' or '-'", ErrInvalidSchedule)
+	}
+	cronSchedule, err := cron.ParseStandard(schedule.Cron)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid cron expression %q: %v", ErrInvalidSchedule, schedule.Cron, err)
+	}
+	if len(schedule.Seeds) == 0 {
+		return nil, fmt.Errorf("%w: at least one seed URL is required", ErrInvalidSchedule)
+	}
+	for _, seed := range schedule.Seeds {
+		u, err := url.Parse(seed)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: invalid seed URL %q", ErrInvalidSchedule, seed)
+		}
+	}
+	opts, err := s.options(schedule)
+	if err != nil {
+		return nil, err
+	}
+	if err := crawler.ValidateCrawlOptions(opts); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+
+	now := time.Now()
+	schedule.CreatedAt = now
+	if replaces {
+		schedule.CreatedAt = previous.CreatedAt
+		schedule.LastRunAt = previous.LastRunAt
+		schedule.LastCrawlID = previous.LastCrawlID
+		if previous.Cron == schedule.Cron && previous.Enabled == schedule.Enabled {
+			schedule.NextRunAt = previous.NextRunAt
+		}
+	}
+	if schedule.NextRunAt.IsZero() {
+		schedule.NextRunAt = cronSchedule.Next(now)
+	}
+	return &entry{schedule: schedule, cron: cronSchedule}, nil
+}
+
+// options applies a schedule's overrides to the configured crawl defaults
+func (s *Scheduler) options(schedule database.CrawlSchedule) (crawler.CrawlOptions, error) {
+	opts := crawler.DefaultCrawlOptions(s.defaults)
+	if schedule.Options == "" {
+		return opts, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(schedule.Options)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&opts); err != nil {
+		return opts, fmt.Errorf("%w: invalid crawl options: %v", ErrInvalidSchedule, err)
+	}
+	return opts, nil
+}
+
+// List returns every schedule ordered by name
+func (s *Scheduler) List() []database.CrawlSchedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedules := make([]database.CrawlSchedule, 0, len(s.entries))
+	for _, e := range s.entries {
+		schedules = append(schedules, e.schedule)
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].Name < schedules[j].Name })
+	return schedules
+}
+
+// Get returns a schedule by name
+func (s *Scheduler) Get(name string) (database.CrawlSchedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return database.CrawlSchedule{}, ErrScheduleNotFound
+	}
+	return e.schedule, nil
+}
+
+// Create adds a new schedule. It returns ErrScheduleExists if the name is taken.
+func (s *Scheduler) Create(ctx context.Context, schedule database.CrawlSchedule) (database.CrawlSchedule, error) {
+	return s.save(ctx, schedule, false)
+}
+
+// Save creates a schedule or replaces the one with the same name. Schedules
+// defined in the config file can't be replaced.
+func (s *Scheduler) Save(ctx context.Context, schedule database.CrawlSchedule) (database.CrawlSchedule, error) {
+	return s.save(ctx, schedule, true)
+}
+
+func (s *Scheduler) save(ctx context.Context, schedule database.CrawlSchedule, replace bool) (database.CrawlSchedule, error) {
+	schedule.Source = SourceAPI
+	schedule.LastRunAt = time.Time{}
+	schedule.NextRunAt = time.Time{}
+	schedule.LastCrawlID = ""
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, exists := s.entries[schedule.Name]
+	if exists && !replace {
+		return schedule, ErrScheduleExists
+	}
+	if exists && previous.schedule.Source == SourceConfig {
+		return schedule, ErrConfigSchedule
+	}
+
+	var e *entry
+	var err error
+	if exists {
+		e, err = s.prepare(schedule, previous.schedule, true)
+	} else {
+		e, err = s.prepare(schedule, database.CrawlSchedule{}, false)
+	}
+	if err != nil {
+		return schedule, err
+	}
+	if err := s.storage.SaveCrawlSchedule(ctx, e.schedule); err != nil {
+		return schedule, err
+	}
+	s.entries[schedule.Name] = e
+	return e.schedule, nil
+}
+
+// Delete removes a schedule. Schedules defined in the config file can't be deleted.
+func (s *Scheduler) Delete(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	if e.schedule.Source == SourceConfig {
+		return ErrConfigSchedule
+	}
+	if err := s.storage.DeleteCrawlSchedule(ctx, name); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	delete(s.entries, name)
+	return nil
+}
+
+// Start begins firing due schedules in the background
+func (s *Scheduler) Start(ctx context.Context) {
+	s.wg.Add(1)
+	go s.run(ctx)
+	log.Println("Crawl scheduler started.")
+}
+
+// Stop stops firing schedules and waits for a run in progress to finish
+func (s *Scheduler) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+	log.Println("Crawl scheduler stopped.")
+}
+
+// run checks for due schedules until the scheduler is stopped
+func (s *Scheduler) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.fireDue(ctx)
+		}
+	}
+}
+
+// fireDue fires every enabled schedule whose next run has come
+func (s *Scheduler) fireDue(ctx context.Context) {
+	now := time.Now()
+
+	s.mu.Lock()
+	var due []*entry
+	for _, e := range s.entries {
+		if e.schedule.Enabled && !e.schedule.NextRunAt.After(now) {
+			due = append(due, e)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, e := range due {
+		s.fire(ctx, e, now)
+	}
+}
+
+// fire starts a run of a schedule unless another node claimed it or the previous
+// run is still going, then records the run and when the schedule is due next
+func (s *Scheduler) fire(ctx context.Context, e *entry, now time.Time) {
+	s.mu.Lock()
+	schedule := e.schedule
+	s.mu.Unlock()
+
+	next := e.cron.Next(now)
+
+	// The claim lasts until just before the next run so that one can be claimed again
+	ttl := time.Until(next) - time.Second
+	if ttl < minClaimTTL {
+		ttl = minClaimTTL
+	}
+
+	claimed, err := s.lock.Claim(ctx, schedule.Name, ttl)
+	if err != nil || !claimed {
+		outcome := OutcomeClaimed
+		if err != nil {
+			log.Printf("Error claiming schedule %s: %v", schedule.Name, err)
+			outcome = OutcomeFailed
+		}
+		s.metrics.RecordScheduledRun(schedule.Name, outcome)
+		// The node that holds the claim records the run, only move on to the next one
+		s.advance(ctx, e, schedule.Name, next)
+		return
+	}
+
+	// The previous run may have been fired by another node, which recorded it in storage
+	if stored, err := s.storage.GetCrawlSchedule(ctx, schedule.Name); err != nil {
+		log.Printf("Error reloading schedule %s, using its last run known here: %v", schedule.Name, err)
+	} else {
+		schedule.LastRunAt, schedule.LastCrawlID = stored.LastRunAt, stored.LastCrawlID
+	}
+	lastRunAt, crawlID := schedule.LastRunAt, schedule.LastCrawlID
+
+	var outcome string
+	if s.crawler.CrawlActive(schedule.LastCrawlID) {
+		log.Printf("Schedule %s is due but crawl %s of its previous run is still going, skipping", schedule.Name, schedule.LastCrawlID)
+		outcome = OutcomeOverlap
+	} else {
+		var id string
+		if outcome, id = s.start(ctx, schedule); id != "" {
+			// The crawl exists even if not every seed could be enqueued
+			lastRunAt, crawlID = now, id
+		}
+	}
+	s.metrics.RecordScheduledRun(schedule.Name, outcome)
+
+	if err := s.storage.UpdateCrawlScheduleRun(ctx, schedule.Name, lastRunAt, next, crawlID); err != nil {
+		log.Printf("Error recording run of schedule %s: %v", schedule.Name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The schedule may have been replaced or deleted meanwhile
+	if s.entries[schedule.Name] == e {
+		e.schedule.LastRunAt = lastRunAt
+		e.schedule.LastCrawlID = crawlID
+		e.schedule.NextRunAt = next
+	}
+}
+
+// advance records when a schedule fires next without touching its last run
+func (s *Scheduler) advance(ctx context.Context, e *entry, name string, next time.Time) {
+	if err := s.storage.UpdateCrawlScheduleNextRun(ctx, name, next); err != nil {
+		log.Printf("Error recording next run of schedule %s: %v", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries[name] == e {
+		e.schedule.NextRunAt = next
+	}
+}
+
+// start starts the crawl of a schedule run and returns the outcome and the crawl ID
+func (s *Scheduler) start(ctx context.Context, schedule database.CrawlSchedule) (string, string) {
+	opts, err := s.options(schedule)
+	if err != nil {
+		log.Printf("Error starting schedule %s: %v", schedule.Name, err)
+		return OutcomeFailed, ""
+	}
+
+	id, err := s.crawler.StartCrawl(ctx, schedule.Seeds, opts)
+	if err != nil {
+		log.Printf("Error starting crawl for schedule %s: %v", schedule.Name, err)
+		return OutcomeFailed, id
+	}
+
+	log.Printf("Schedule %s started crawl %s", schedule.Name, id)
+	return OutcomeStarted, id
+}